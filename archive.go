@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveMember is a regular file read from a tar or zip archive.
+type archiveMember struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// archiveKind returns "tar" or "zip" for archive names, including
+// compressed tarballs like bundle.tar.gz and bundle.tgz, and "" otherwise.
+func archiveKind(name string) string {
+	switch strings.ToLower(filepath.Ext(trimCompressionExt(name))) {
+	case ".tar", ".tgz", ".tzst", ".txz":
+		return "tar"
+	case ".zip":
+		return "zip"
+	default:
+		return ""
+	}
+}
+
+func hasArchive(inputs []string) bool {
+	for _, input := range inputs {
+		if archiveKind(input) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveStem is the archive's name without its extensions, which names
+// the directory its members are extracted to.
+func archiveStem(name string) string {
+	base := trimCompressionExt(filepath.Base(name))
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// readArchive reads the regular files of an archive into memory, so
+// members are converted without being extracted to disk first.
+func (o options) readArchive(name string) ([]archiveMember, error) {
+	data, err := o.readInput(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []archiveMember
+	if archiveKind(name) == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			member := archiveMember{mode: f.Mode().Perm(), modTime: f.Modified}
+			if member.name, err = memberName(f.Name); err != nil {
+				return nil, fmt.Errorf("read %s: %w", name, err)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("read %s:%s: %w", name, f.Name, err)
+			}
+			member.data, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("read %s:%s: %w", name, f.Name, err)
+			}
+			members = append(members, member)
+		}
+		return members, nil
+	}
+
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		member := archiveMember{mode: hdr.FileInfo().Mode().Perm(), modTime: hdr.ModTime}
+		if member.name, err = memberName(hdr.Name); err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		if member.data, err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("read %s:%s: %w", name, hdr.Name, err)
+		}
+		members = append(members, member)
+	}
+}
+
+// memberName refuses member paths that would escape the output directory.
+func memberName(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("unsafe member path %q", name)
+	}
+	return clean, nil
+}
+
+// selected applies --include and --exclude to a member path, the way the
+// directory walker does.
+func (o options) selected(member string) bool {
+	w := &inputWalker{opts: o}
+	return !w.excluded(member, false) && w.included(member, member)
+}
+
+func (o options) memberJob(archive string, m archiveMember, output string) (batchJob, error) {
+	fromFormat, err := o.resolveFromFormat(m.name)
+	if err != nil && !o.keepGoing {
+		return batchJob{}, fmt.Errorf("%s:%s: %w", archive, m.name, err)
+	}
+	return batchJob{
+		input:  archive + ":" + m.name,
+		output: output,
+		from:   fromFormat,
+		to:     o.batchTarget,
+		data:   m.data,
+		err:    err,
+	}, nil
+}
+
+// planArchive plans the members of an archive for extraction into a tree,
+// next to the archive in a directory named after it unless --out-dir is
+// given.
+func (o options) planArchive(archive string) ([]batchJob, error) {
+	members, err := o.readArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	if o.outDir == "" {
+		o.outDir = filepath.Join(filepath.Dir(archive), archiveStem(archive))
+	}
+
+	var jobs []batchJob
+	for _, m := range members {
+		if !o.selected(m.name) {
+			continue
+		}
+		output := o.templateDestination(filepath.FromSlash(path.Dir(m.name)), path.Base(trimCompressionExt(m.name)))
+		job, err := o.memberJob(archive, m, output)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// convertMember converts an archive member. Members compressed on their
+// own, like data.msgpack.gz, are recognized by their magic bytes.
+func (o options) convertMember(job batchJob) ([]byte, error) {
+	data, err := decompressData(job.data, sniffCompression(job.data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", job.input, err)
+	}
+	return o.convertInput(data, job.from, job.to)
+}
+
+// convertToArchive writes a copy of the input archive with every selected
+// member converted and renamed, and the other members as they were.
+func (o options) convertToArchive() error {
+	if len(o.inputs) != 1 || archiveKind(o.inputs[0]) == "" {
+		return fmt.Errorf("--out-archive expects exactly one tar or zip input: %w", errUsage)
+	}
+	archive := o.inputs[0]
+	if archiveKind(o.outArchive) == "" {
+		return fmt.Errorf("--out-archive %s is not a .tar, .tar.gz, .tgz or .zip name: %w", o.outArchive, errUsage)
+	}
+	if absPath(archive) == absPath(o.outArchive) || sameFile(archive, o.outArchive) {
+		return fmt.Errorf("refusing to overwrite input %s", archive)
+	}
+	if !o.force && !o.backup && fileExists(o.outArchive) {
+		return fmt.Errorf("%s already exists (use --force or --backup to overwrite)", o.outArchive)
+	}
+
+	members, err := o.readArchive(archive)
+	if err != nil {
+		return err
+	}
+	var jobs []batchJob
+	jobFor := make(map[string]int)
+	names := make(map[string]bool)
+	for _, m := range members {
+		names[m.name] = true
+	}
+	for _, m := range members {
+		if !o.selected(m.name) {
+			continue
+		}
+		rel := o.templateDestination(path.Dir(m.name), path.Base(trimCompressionExt(m.name)))
+		rel = filepath.ToSlash(rel)
+		job, err := o.memberJob(archive, m, o.outArchive+":"+rel)
+		if err != nil {
+			return err
+		}
+		// A member left as it is would end up twice in the archive.
+		if names[rel] && rel != m.name && !o.selected(rel) {
+			job.err = fmt.Errorf("%s would replace member %s", job.output, rel)
+			if !o.keepGoing {
+				return job.err
+			}
+		}
+		jobFor[m.name] = len(jobs)
+		jobs = append(jobs, job)
+	}
+	if err := o.checkJobs(jobs); err != nil {
+		return err
+	}
+
+	if o.dryRun {
+		for _, job := range jobs {
+			note := ""
+			if job.err != nil {
+				note = fmt.Sprintf(" (fail: %v)", job.err)
+			}
+			fmt.Printf("%s -> %s%s\n", job.input, job.output, note)
+		}
+		return nil
+	}
+
+	errs := make([]error, len(jobs))
+	converted := make([][]byte, len(jobs))
+	for i, job := range jobs {
+		if errs[i] = job.err; errs[i] != nil {
+			continue
+		}
+		converted[i], errs[i] = o.convertMember(job)
+		if errs[i] == nil {
+			name := strings.TrimPrefix(job.output, o.outArchive+":")
+			converted[i], errs[i] = compressData(converted[i], o.outputCompression(name), o.level)
+		}
+		if errs[i] != nil && !o.keepGoing {
+			return errs[i]
+		}
+	}
+
+	var out bytes.Buffer
+	if err := o.writeArchive(&out, members, func(m archiveMember) (string, []byte) {
+		i, ok := jobFor[m.name]
+		if !ok || errs[i] != nil {
+			return m.name, m.data
+		}
+		return strings.TrimPrefix(jobs[i].output, o.outArchive+":"), converted[i]
+	}); err != nil {
+		return fmt.Errorf("write %s: %w", o.outArchive, err)
+	}
+	data, err := compressData(out.Bytes(), o.archiveCompression(), o.level)
+	if err != nil {
+		return fmt.Errorf("compress %s: %w", o.outArchive, err)
+	}
+	if err := writeFileAtomic(o.outArchive, data, o.backup); err != nil {
+		return fmt.Errorf("write %s: %w", o.outArchive, err)
+	}
+	return o.finishJobs(jobs, errs, false)
+}
+
+// archiveCompression is the compression of the output tarball, from its
+// name: bundle.tar.gz, bundle.tgz and so on. Zip compresses each member.
+func (o options) archiveCompression() Compression {
+	c, _ := compressionFromExt(o.outArchive)
+	switch strings.ToLower(filepath.Ext(o.outArchive)) {
+	case ".tgz":
+		c = CompressionGzip
+	case ".tzst":
+		c = CompressionZstd
+	case ".txz":
+		c = CompressionXZ
+	}
+	return c
+}
+
+// writeArchive writes members in their original order, under the name and
+// contents rename picks for each.
+func (o options) writeArchive(w io.Writer, members []archiveMember, rename func(archiveMember) (string, []byte)) error {
+	if archiveKind(o.outArchive) == "zip" {
+		zw := zip.NewWriter(w)
+		for _, m := range members {
+			name, data := rename(m)
+			hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: m.modTime}
+			hdr.SetMode(m.mode)
+			f, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	}
+
+	tw := tar.NewWriter(w)
+	for _, m := range members {
+		name, data := rename(m)
+		hdr := &tar.Header{Name: name, Mode: int64(m.mode), Size: int64(len(data)), ModTime: m.modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// batchJob is one planned conversion from an input file to an output file.
+// Under --keep-going, a job that cannot be converted carries the reason
+// instead of failing the whole plan. Jobs for archive members hold the
+// member's contents in data, and input names the member as archive:path.
+type batchJob struct {
+	input  string
+	output string
+	from   Format
+	to     Format
+	data   []byte
+	skip   string
+	err    error
+}
+
+func convertFilePair(inputPath, outputPath string, opts options) error {
+	fromFormat, err := opts.resolveFromFormat(inputPath)
+	if err != nil {
+		return err
+	}
+
+	toFormat, err := opts.resolveToFormat(outputPath)
+	if err != nil {
+		return err
+	}
+
+	return opts.runJobs([]batchJob{{input: inputPath, output: outputPath, from: fromFormat, to: toFormat}})
+}
+
+func batchConvert(opts options) error {
+	if opts.outArchive != "" {
+		return opts.convertToArchive()
+	}
+	jobs, err := opts.planBatch()
+	if err != nil {
+		return err
+	}
+	return opts.runJobs(jobs)
+}
+
+func (o options) planBatch() ([]batchJob, error) {
+	inputs, root, err := o.collectInputs()
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no input files found for batch conversion")
+	}
+
+	jobs := make([]batchJob, 0, len(inputs))
+	for _, input := range inputs {
+		if archiveKind(input) != "" {
+			if o.incremental() {
+				return nil, fmt.Errorf("--newer and --manifest cannot be used with archive input %s: %w", input, errUsage)
+			}
+			members, err := o.planArchive(input)
+			if err != nil {
+				return nil, err
+			}
+			jobs = append(jobs, members...)
+			continue
+		}
+		fromFormat, err := o.resolveFromFormat(input)
+		if err != nil && !o.keepGoing {
+			return nil, err
+		}
+		jobs = append(jobs, batchJob{
+			input:  input,
+			output: o.batchDestination(input, root),
+			from:   fromFormat,
+			to:     o.batchTarget,
+			err:    err,
+		})
+	}
+	return jobs, nil
+}
+
+// runJobs checks the whole plan before writing anything, so a bad plan
+// leaves every file untouched.
+func (o options) runJobs(jobs []batchJob) error {
+	var m *manifest
+	switch {
+	case o.newer:
+		skipNewer(jobs)
+	case o.manifestFile != "":
+		var err error
+		if m, err = loadManifest(o.manifestFile); err != nil {
+			return err
+		}
+		if m.options, err = o.outputDigest(); err != nil {
+			return err
+		}
+		m.skipUnchanged(jobs)
+	}
+	if err := o.checkJobs(jobs); err != nil {
+		return err
+	}
+
+	if o.dryRun {
+		for _, job := range jobs {
+			note := ""
+			switch {
+			case job.err != nil:
+				note = fmt.Sprintf(" (fail: %v)", job.err)
+			case job.skip != "":
+				note = " (skip: " + job.skip + ")"
+			case fileExists(job.output):
+				note = " (overwrite)"
+				if o.backup {
+					note = " (overwrite, backup to " + job.output + ".bak)"
+				}
+			}
+			fmt.Printf("%s -> %s%s\n", job.input, job.output, note)
+		}
+		return nil
+	}
+
+	errs, interrupted := o.convertJobs(jobs)
+	if m != nil {
+		m.update(jobs, errs)
+		if err := m.save(); err != nil {
+			return err
+		}
+	}
+	return o.finishJobs(jobs, errs, interrupted)
+}
+
+// finishJobs writes the --report file and the --keep-going summary, and
+// turns the outcome into the error run returns.
+func (o options) finishJobs(jobs []batchJob, errs []error, interrupted bool) error {
+	report := newBatchReport(jobs, errs, interrupted)
+	if o.reportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(o.reportFile, appendNewline(data), false); err != nil {
+			return fmt.Errorf("write report %s: %w", o.reportFile, err)
+		}
+	}
+	if o.keepGoing {
+		report.write(os.Stderr)
+	}
+
+	if interrupted {
+		return fmt.Errorf("interrupted after converting %d of %d files", report.Converted, len(jobs))
+	}
+	if report.Failed == 0 {
+		return nil
+	}
+	if o.keepGoing {
+		return fmt.Errorf("%s of %d failed", plural(report.Failed, "file"), len(jobs))
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertJobs converts jobs on a pool of -j workers and returns each job's
+// error in plan order. Without --keep-going, the first failure stops new
+// jobs from starting; Ctrl-C always does. Running jobs finish or discard
+// their output, and since outputs are written atomically no half-written
+// file is left behind either way.
+func (o options) convertJobs(jobs []batchJob) ([]error, bool) {
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second Ctrl-C exits immediately.
+		<-interrupted.Done()
+		stop()
+	}()
+	ctx, cancel := context.WithCancel(interrupted)
+	defer cancel()
+
+	workers := o.jobs
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = max(min(workers, len(jobs)), 1)
+
+	errs := make([]error, len(jobs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if errs[i] = o.convertJob(ctx, jobs[i]); errs[i] != nil && !o.keepGoing {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i, job := range jobs {
+		if job.err != nil || job.skip != "" {
+			errs[i] = job.err
+			continue
+		}
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+	return errs, interrupted.Err() != nil
+}
+
+func (o options) convertJob(ctx context.Context, job batchJob) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(job.output), 0o755); err != nil {
+		return err
+	}
+	if job.data != nil {
+		converted, err := o.convertMember(job)
+		if err != nil {
+			return err
+		}
+		return o.writeOutput(ctx, job.output, converted)
+	}
+	return o.convertAndWriteContext(ctx, job.input, job.output, job.from, job.to)
+}
+
+// checkJobs refuses plans that write over an input, send two inputs to the
+// same output, or replace existing files without --force, --backup or an
+// incremental mode.
+// Under --keep-going, the offending jobs fail or are skipped instead.
+func (o options) checkJobs(jobs []batchJob) error {
+	inputs := make(map[string]string, len(jobs))
+	for _, job := range jobs {
+		inputs[absPath(job.input)] = job.input
+	}
+
+	outputs := make(map[string]string, len(jobs))
+	for i := range jobs {
+		job := &jobs[i]
+		if job.err != nil || job.skip != "" {
+			continue
+		}
+		skip, err := o.checkJob(*job, inputs, outputs)
+		switch {
+		case err != nil && o.keepGoing:
+			job.err = err
+		case err != nil:
+			return err
+		case skip != "" && o.keepGoing:
+			job.skip = skip
+		case skip != "":
+			return errors.New(skip)
+		}
+	}
+	return nil
+}
+
+// checkJob returns an error for jobs that must not run, and a reason for
+// jobs that would replace an existing output without permission.
+func (o options) checkJob(job batchJob, inputs, outputs map[string]string) (string, error) {
+	out := absPath(job.output)
+	if input, ok := inputs[out]; ok {
+		return "", fmt.Errorf("refusing to overwrite input %s with the output for %s", input, job.input)
+	}
+	if sameFile(job.input, job.output) {
+		return "", fmt.Errorf("refusing to overwrite input %s: %s is the same file", job.input, job.output)
+	}
+	if other, ok := outputs[out]; ok {
+		return "", fmt.Errorf("%s and %s would both be written to %s", other, job.input, job.output)
+	}
+	outputs[out] = job.input
+	if input, ok := inputs[out+".bak"]; ok && o.backup {
+		return "", fmt.Errorf("refusing to replace input %s with the backup of %s", input, job.output)
+	}
+	if !o.force && !o.backup && !o.incremental() && fileExists(job.output) {
+		return fmt.Sprintf("%s already exists (use --force or --backup to overwrite)", job.output), nil
+	}
+	return "", nil
+}
+
+// batchReport is the --keep-going summary and the --report file.
+type batchReport struct {
+	Converted int           `json:"converted"`
+	Skipped   int           `json:"skipped"`
+	Failed    int           `json:"failed"`
+	Files     []batchResult `json:"files"`
+}
+
+type batchResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func newBatchReport(jobs []batchJob, errs []error, interrupted bool) *batchReport {
+	report := &batchReport{Files: make([]batchResult, 0, len(jobs))}
+	for i, job := range jobs {
+		result := batchResult{Input: job.input, Output: job.output, Status: "converted"}
+		switch err := errs[i]; {
+		case job.skip != "":
+			result.Status, result.Reason = "skipped", job.skip
+		case errors.Is(err, context.Canceled) && interrupted:
+			result.Status, result.Reason = "skipped", "interrupted"
+		case errors.Is(err, context.Canceled):
+			result.Status, result.Reason = "skipped", "stopped after an earlier failure"
+		case err != nil:
+			result.Status, result.Reason = "failed", err.Error()
+		}
+		switch result.Status {
+		case "converted":
+			report.Converted++
+		case "skipped":
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+		report.Files = append(report.Files, result)
+	}
+	return report
+}
+
+func (r *batchReport) write(w io.Writer) {
+	fmt.Fprintf(w, "converted %s, skipped %d, failed %d\n", plural(r.Converted, "file"), r.Skipped, r.Failed)
+	for _, status := range []string{"failed", "skipped"} {
+		header := false
+		for _, f := range r.Files {
+			if f.Status != status {
+				continue
+			}
+			if !header {
+				fmt.Fprintln(w, status+":")
+				header = true
+			}
+			fmt.Fprintf(w, "  %s: %s\n", f.Input, f.Reason)
+		}
+	}
+}
+
+func deriveBatchDestination(inputPath string, target Format) string {
+	inputPath = trimCompressionExt(inputPath)
+	base := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
+	ext := target.DefaultExt()
+	if ext == "" {
+		return inputPath
+	}
+	return base + "." + ext
+}
+
+const defaultOutTemplate = "{dir}/{name}.{ext}"
+
+// batchDestination applies --out-dir and --out-template. Under --out-dir,
+// {dir} is the input's directory relative to root, so the input tree is
+// mirrored; otherwise it is the input's own directory. {ext} carries the
+// --compress suffix, as in json.gz.
+func (o options) batchDestination(input, root string) string {
+	if o.outDir == "" && o.outTemplate == "" {
+		return deriveBatchDestination(input, o.batchTarget) + o.compress.suffix()
+	}
+
+	dir := filepath.Dir(input)
+	if o.outDir != "" {
+		if rel, err := filepath.Rel(root, filepath.Dir(absPath(input))); err == nil {
+			dir = rel
+		}
+	}
+	return o.templateDestination(dir, filepath.Base(trimCompressionExt(input)))
+}
+
+// templateDestination expands --out-template for a file named base in
+// dir, under --out-dir.
+func (o options) templateDestination(dir, base string) string {
+	ext := o.batchTarget.DefaultExt()
+	if ext == "" {
+		ext = strings.TrimPrefix(filepath.Ext(base), ".")
+	}
+	ext += o.compress.suffix()
+
+	template := o.outTemplate
+	if template == "" {
+		template = defaultOutTemplate
+	}
+	output := strings.NewReplacer(
+		"{dir}", filepath.ToSlash(dir),
+		"{name}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{ext}", ext,
+	).Replace(template)
+	return filepath.Join(o.outDir, filepath.FromSlash(output))
+}
+
+func checkOutTemplate(template string) error {
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return fmt.Errorf("unclosed placeholder in --out-template %q: %w", template, errUsage)
+		}
+		switch name := rest[start : start+end+1]; name {
+		case "{dir}", "{name}", "{ext}":
+		default:
+			return fmt.Errorf("unknown placeholder %s in --out-template (want {dir}, {name} or {ext}): %w", name, errUsage)
+		}
+		rest = rest[start+end+1:]
+	}
+	return nil
+}
+
+// commonDir is the deepest directory containing every one of dirs.
+func commonDir(dirs []string) string {
+	var common []string
+	for i, dir := range dirs {
+		parts := strings.Split(absPath(dir), string(filepath.Separator))
+		if i == 0 {
+			common = parts
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	if len(common) == 1 && common[0] == "" {
+		return string(filepath.Separator)
+	}
+	return strings.Join(common, string(filepath.Separator))
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// sameFile catches outputs that reach an input through a symlink or hard
+// link.
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
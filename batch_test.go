@@ -0,0 +1,500 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestBatchSafeguards(t *testing.T) {
+	dir := setupTestDir(t)
+	jsonFile := filepath.Join(dir, "a.json")
+	ymlFile := filepath.Join(dir, "b.yml")
+	yamlFile := filepath.Join(dir, "b.yaml")
+	writeTestFile(t, jsonFile, []byte(`{"a":1}`))
+	writeTestFile(t, ymlFile, []byte("b: 1\n"))
+	writeTestFile(t, yamlFile, []byte("b: 2\n"))
+
+	err := run([]string{"--to-json", jsonFile})
+	assertError(t, err, "refusing to overwrite input")
+
+	err = run([]string{"--to-json", ymlFile, yamlFile})
+	assertError(t, err, "would both be written to")
+	if fileExists(filepath.Join(dir, "b.json")) {
+		t.Error("a rejected plan should not write any file")
+	}
+
+	err = run([]string{jsonFile, ymlFile})
+	assertError(t, err, "already exists (use --force")
+
+	if err := run([]string{"--dry-run", "--to-msgpack", jsonFile, ymlFile}); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if fileExists(filepath.Join(dir, "a.msgpack")) {
+		t.Error("dry run should not write files")
+	}
+
+	if err := run([]string{"--to-msgpack", jsonFile}); err != nil {
+		t.Fatalf("batch conversion failed: %v", err)
+	}
+	err = run([]string{"--to-msgpack", jsonFile})
+	assertError(t, err, "already exists")
+	if err := run([]string{"--force", "--to-msgpack", jsonFile}); err != nil {
+		t.Errorf("--force should allow overwriting outputs: %v", err)
+	}
+
+	cFile := filepath.Join(dir, "c.yaml")
+	writeTestFile(t, cFile, []byte("c: 1\n"))
+	if err := os.Symlink(cFile, filepath.Join(dir, "c.json")); err == nil {
+		err = run([]string{"--force", "--to-json", cFile})
+		assertError(t, err, "is the same file")
+	}
+}
+
+func TestAtomicWriteBackup(t *testing.T) {
+	dir := setupTestDir(t)
+	input := filepath.Join(dir, "data.json")
+	output := filepath.Join(dir, "data.yaml")
+	writeTestFile(t, input, []byte(`{"version":2}`))
+	writeTestFile(t, output, []byte("version: 1\n"))
+	if err := os.Chmod(output, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run([]string{"--backup", input, output}); err != nil {
+		t.Fatalf("conversion with --backup failed: %v", err)
+	}
+
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "version: 2\n" {
+		t.Errorf("output = %q, want the new version", got)
+	}
+	old, err := os.ReadFile(output + ".bak")
+	if err != nil {
+		t.Fatalf("backup not written: %v", err)
+	}
+	if string(old) != "version: 1\n" {
+		t.Errorf("backup = %q, want the previous version", old)
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("output mode = %v, want 0600 to be preserved", info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected only input, output and backup, found %v", names)
+	}
+}
+
+func TestAtomicWriteModeAndLinks(t *testing.T) {
+	dir := setupTestDir(t)
+
+	// New files get the mode os.WriteFile would give them under the umask.
+	reference := filepath.Join(dir, "reference")
+	if err := os.WriteFile(reference, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "created.json")
+	if err := writeFileAtomic(created, []byte("{}\n"), false); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+	want, _ := os.Stat(reference)
+	got, _ := os.Stat(created)
+	if got.Mode().Perm() != want.Mode().Perm() {
+		t.Errorf("new file mode = %v, want %v", got.Mode().Perm(), want.Mode().Perm())
+	}
+
+	target := filepath.Join(dir, "target.json")
+	link := filepath.Join(dir, "link.json")
+	writeTestFile(t, target, []byte("{}\n"))
+	if err := os.Symlink("target.json", link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := writeFileAtomic(link, []byte(`{"a":1}`+"\n"), false); err != nil {
+		t.Fatalf("writeFileAtomic through a symlink failed: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected %s to stay a symlink", link)
+	}
+	if data, _ := os.ReadFile(target); string(data) != `{"a":1}`+"\n" {
+		t.Errorf("target = %q, want the new contents", data)
+	}
+}
+
+func TestBatchOutDir(t *testing.T) {
+	dir := setupTestDir(t)
+	src := filepath.Join(dir, "src")
+	build := filepath.Join(dir, "build")
+	if err := os.MkdirAll(filepath.Join(src, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(src, "a.yaml"), []byte("a: 1\n"))
+	writeTestFile(t, filepath.Join(src, "nested", "b.yaml"), []byte("b: 2\n"))
+
+	inputs := []string{filepath.Join(src, "a.yaml"), filepath.Join(src, "nested", "b.yaml")}
+	if err := run(append([]string{"--to-msgpack", "--out-dir", build}, inputs...)); err != nil {
+		t.Fatalf("--out-dir conversion failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(build, "a.msgpack"))
+	assertFileExists(t, filepath.Join(build, "nested", "b.msgpack"))
+
+	args := append([]string{"--to-json", "--out-template", "{dir}/{name}.out.{ext}"}, inputs...)
+	if err := run(args); err != nil {
+		t.Fatalf("--out-template conversion failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(src, "a.out.json"))
+	assertFileExists(t, filepath.Join(src, "nested", "b.out.json"))
+
+	args = append([]string{"--to-json", "--out-dir", build, "--out-template", "{name}.{ext}"}, inputs...)
+	if err := run(args); err != nil {
+		t.Fatalf("flattening template failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(build, "b.json"))
+
+	err := run([]string{"--to-json", "--out-template", "{stem}.{ext}", inputs[0]})
+	assertError(t, err, "unknown placeholder {stem}")
+	err = run([]string{"--out-dir", build, inputs[0], filepath.Join(dir, "a.json")})
+	assertError(t, err, "--out-dir and --out-template require")
+}
+
+func TestRecursiveConvert(t *testing.T) {
+	dir := setupTestDir(t)
+	root := filepath.Join(dir, "configs")
+	for _, sub := range []string{"vendor", "sub"} {
+		if err := os.MkdirAll(filepath.Join(root, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFile(t, filepath.Join(root, "a.yaml"), []byte("a: 1\n"))
+	writeTestFile(t, filepath.Join(root, "b.json"), []byte(`{"b":2}`))
+	writeTestFile(t, filepath.Join(root, "notes.txt"), []byte("not data"))
+	writeTestFile(t, filepath.Join(root, "vendor", "x.yaml"), []byte("x: 1\n"))
+	writeTestFile(t, filepath.Join(root, "sub", "c.yaml"), []byte("c: 3\n"))
+	writeTestFile(t, filepath.Join(root, "sub", "skip.yaml"), []byte("skip: true\n"))
+	writeTestFile(t, filepath.Join(root, "sub", ".mptignore"), []byte("# generated\nskip.yaml\n"))
+	if err := os.Symlink(root, filepath.Join(root, "sub", "loop")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	err := run([]string{"convert", "--to-msgpack", root})
+	assertError(t, err, "is a directory (use -r")
+
+	if err := run([]string{"convert", "-r", root, "--to-msgpack", "--exclude", "vendor/**"}); err != nil {
+		t.Fatalf("recursive conversion failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(root, "a.msgpack"))
+	assertFileExists(t, filepath.Join(root, "b.msgpack"))
+	assertFileExists(t, filepath.Join(root, "sub", "c.msgpack"))
+	for _, name := range []string{"vendor/x.msgpack", "sub/skip.msgpack", "notes.msgpack"} {
+		if fileExists(filepath.Join(root, filepath.FromSlash(name))) {
+			t.Errorf("%s should not have been written", name)
+		}
+	}
+
+	// The outputs are in the target format, so a second run does not pick
+	// them up as inputs.
+	if err := run([]string{"convert", "-r", root, "--to-msgpack", "--exclude", "vendor/**", "--force"}); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+
+	if err := run([]string{"-r", root, "--to-yaml", "--include", "*.json"}); err != nil {
+		t.Fatalf("--include conversion failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(root, "b.yaml"))
+
+	files, _, err := options{inputs: []string{root}, recursive: true, batchTarget: FormatJSON, include: []string{"**/*.yaml"}}.collectInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.yaml", "b.yaml", "sub/c.yaml", "vendor/x.yaml"}
+	if len(files) != len(want) {
+		t.Fatalf("collected %v, want %v", files, want)
+	}
+	for i, file := range files {
+		if rel, _ := filepath.Rel(root, file); filepath.ToSlash(rel) != want[i] {
+			t.Errorf("file %d = %s, want %s", i, rel, want[i])
+		}
+	}
+}
+
+func TestParallelBatch(t *testing.T) {
+	dir := setupTestDir(t)
+	var inputs []string
+	for i := range 40 {
+		input := filepath.Join(dir, fmt.Sprintf("doc%02d.json", i))
+		writeTestFile(t, input, []byte(fmt.Sprintf(`{"n":%d}`, i)))
+		inputs = append(inputs, input)
+	}
+	bad := filepath.Join(dir, "doc05.json")
+	writeTestFile(t, bad, []byte(`{"n":`))
+
+	err := run(append([]string{"-j", "8", "--to-msgpack"}, inputs...))
+	if err == nil {
+		t.Fatal("expected the malformed input to fail the batch")
+	}
+
+	if err := os.Remove(bad); err != nil {
+		t.Fatal(err)
+	}
+	inputs = append(inputs[:5], inputs[6:]...)
+	if err := run(append([]string{"-j", "8", "--force", "--to-msgpack"}, inputs...)); err != nil {
+		t.Fatalf("parallel batch failed: %v", err)
+	}
+	for i, input := range inputs {
+		data, err := os.ReadFile(deriveBatchDestination(input, FormatMsgpack))
+		if err != nil {
+			t.Fatalf("output %d missing: %v", i, err)
+		}
+		var got map[string]int
+		if err := msgpack.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		want := i
+		if i >= 5 {
+			want++
+		}
+		if got["n"] != want {
+			t.Errorf("%s holds n=%d, want %d", input, got["n"], want)
+		}
+	}
+
+	err = run([]string{"-j", "0", "--to-json", inputs[0]})
+	assertError(t, err, "-j")
+}
+
+func TestKeepGoingReport(t *testing.T) {
+	dir := setupTestDir(t)
+	good := filepath.Join(dir, "good.json")
+	bad := filepath.Join(dir, "bad.json")
+	existing := filepath.Join(dir, "existing.json")
+	writeTestFile(t, good, []byte(`{"ok":true}`))
+	writeTestFile(t, bad, []byte(`{"ok":`))
+	writeTestFile(t, existing, []byte(`{"ok":false}`))
+	writeTestFile(t, filepath.Join(dir, "existing.yaml"), []byte("keep: me\n"))
+	unknown := filepath.Join(dir, "notes.txt")
+	writeTestFile(t, unknown, []byte("text"))
+	report := filepath.Join(dir, "report.json")
+
+	err := run([]string{"--keep-going", "--report", report, "--to-yaml", bad, good, existing, unknown})
+	assertError(t, err, "2 files of 4 failed")
+	assertFileExists(t, filepath.Join(dir, "good.yaml"))
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("report not written: %v", err)
+	}
+	var got batchReport
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Converted != 1 || got.Skipped != 1 || got.Failed != 2 {
+		t.Errorf("report counts = %d converted, %d skipped, %d failed", got.Converted, got.Skipped, got.Failed)
+	}
+	statuses := []string{"failed", "converted", "skipped", "failed"}
+	for i, f := range got.Files {
+		if f.Status != statuses[i] {
+			t.Errorf("file %s status = %s, want %s", f.Input, f.Status, statuses[i])
+		}
+	}
+	if kept, _ := os.ReadFile(filepath.Join(dir, "existing.yaml")); string(kept) != "keep: me\n" {
+		t.Errorf("skipped output was overwritten: %q", kept)
+	}
+
+	var buf bytes.Buffer
+	got.write(&buf)
+	summary := buf.String()
+	for _, want := range []string{"converted 1 file, skipped 1, failed 2", "failed:\n  " + bad + ": ", "skipped:\n  " + existing + ": "} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+
+	err = run([]string{"--force", "--to-yaml", bad, good})
+	if err == nil || strings.Contains(err.Error(), "failed") {
+		t.Errorf("without --keep-going the first error should be returned, got %v", err)
+	}
+}
+
+func TestIncrementalBatch(t *testing.T) {
+	dir := setupTestDir(t)
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+	writeTestFile(t, a, []byte(`{"a":1}`))
+	writeTestFile(t, b, []byte(`{"b":1}`))
+	report := filepath.Join(dir, "report.json")
+	readReport := func() batchReport {
+		t.Helper()
+		data, err := os.ReadFile(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r batchReport
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if err := run([]string{"--newer", "--report", report, "--to-yaml", a, b}); err != nil {
+		t.Fatalf("first --newer run failed: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.yaml"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"--newer", "--report", report, "--to-yaml", a, b}); err != nil {
+		t.Fatalf("second --newer run failed: %v", err)
+	}
+	if r := readReport(); r.Converted != 1 || r.Files[0].Status != "converted" || r.Files[1].Reason != upToDate {
+		t.Errorf("expected only the stale output to be rewritten, got %+v", r)
+	}
+
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := filepath.Join(src, "c.json")
+	d := filepath.Join(src, "d.json")
+	writeTestFile(t, c, []byte(`{"c":1}`))
+	writeTestFile(t, d, []byte(`{"d":1}`))
+	manifestFile := filepath.Join(dir, "mpt-manifest.json")
+	args := []string{"--manifest", manifestFile, "--report", report, "-r", src, "--to-msgpack"}
+	if err := run(args); err != nil {
+		t.Fatalf("first --manifest run failed: %v", err)
+	}
+	if r := readReport(); r.Converted != 2 {
+		t.Errorf("first --manifest run converted %d files, want 2", r.Converted)
+	}
+	m, err := loadManifest(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := m.Files["src/c.json"]; entry.Output != "src/c.msgpack" || entry.SHA256 == "" {
+		t.Errorf("manifest entry for c.json = %+v", entry)
+	}
+
+	writeTestFile(t, d, []byte(`{"d":2}`))
+	if err := run(args); err != nil {
+		t.Fatalf("second --manifest run failed: %v", err)
+	}
+	r := readReport()
+	if r.Converted != 1 || r.Skipped != 1 || r.Files[1].Input != d || r.Files[1].Status != "converted" {
+		t.Errorf("expected only the changed input to be converted, got %+v", r)
+	}
+
+	// Different output options make every entry stale.
+	if err := run(append(args, "--output-encoding", "base64")); err != nil {
+		t.Fatalf("--manifest run with new options failed: %v", err)
+	}
+	if r := readReport(); r.Converted != 2 {
+		t.Errorf("changed options converted %d files, want 2", r.Converted)
+	}
+
+	err = run([]string{"--newer", "--manifest", manifestFile, "--to-json", a})
+	assertError(t, err, "cannot be combined")
+
+	bundle := filepath.Join(dir, "bundle.tar.gz")
+	writeTarGz(t, bundle, map[string][]byte{"e.json": []byte(`{"e":1}`)}, []string{"e.json"})
+	err = run([]string{"--newer", "--to-msgpack", bundle})
+	assertError(t, err, "cannot be used with archive input")
+}
+
+func writeTarGz(t *testing.T, name string, files map[string][]byte, order []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, member := range order {
+		hdr := &tar.Header{Name: member, Mode: 0o644, Size: int64(len(files[member])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(files[member]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, name, buf.Bytes())
+}
+
+func TestArchiveInputs(t *testing.T) {
+	dir := setupTestDir(t)
+	a, err := msgpack.Marshal(map[string]interface{}{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := msgpack.Marshal([]interface{}{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"data/a.msgpack": a, "data/b.msgpack": b, "README.txt": []byte("hello")}
+	bundle := filepath.Join(dir, "bundle.tar.gz")
+	writeTarGz(t, bundle, files, []string{"README.txt", "data/a.msgpack", "data/b.msgpack"})
+
+	if err := run([]string{"--to-json", bundle}); err != nil {
+		t.Fatalf("extracting conversion failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "bundle", "data", "a.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, []byte(`{"a":1}`), got)
+	assertFileExists(t, filepath.Join(dir, "bundle", "data", "b.json"))
+	if fileExists(filepath.Join(dir, "bundle", "README.txt")) {
+		t.Error("members that are not converted should not be extracted")
+	}
+
+	out := filepath.Join(dir, "converted.zip")
+	if err := run([]string{"--to-json", bundle, "--out-archive", out, "--exclude", "data/b.*"}); err != nil {
+		t.Fatalf("archive conversion failed: %v", err)
+	}
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := "README.txt data/a.json data/b.msgpack"; strings.Join(names, " ") != want {
+		t.Errorf("archive members = %v, want %s", names, want)
+	}
+
+	err = run([]string{"--to-json", bundle, "--out-archive", out})
+	assertError(t, err, "already exists")
+
+	evil := filepath.Join(dir, "evil.tar.gz")
+	writeTarGz(t, evil, map[string][]byte{"../escape.msgpack": a}, []string{"../escape.msgpack"})
+	err = run([]string{"--to-json", evil})
+	assertError(t, err, "unsafe member path")
+}
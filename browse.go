@@ -0,0 +1,950 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/term"
+)
+
+const (
+	browsePageSize   = 100
+	browseMaxCopy    = 16 << 20
+	browseMaxScalar  = 4096
+	browseMaxSearch  = 1 << 20
+	pagedReaderPage  = 64 << 10
+	pagedReaderPages = 256
+)
+
+// pagedReader reads a msgpack document through a small page cache so that
+// browsing only touches the parts of a file that are looked at.
+type pagedReader struct {
+	r     io.ReaderAt
+	size  int64
+	pages map[int64][]byte
+	order []int64
+}
+
+func newPagedReader(r io.ReaderAt, size int64) *pagedReader {
+	return &pagedReader{r: r, size: size, pages: make(map[int64][]byte)}
+}
+
+func (p *pagedReader) page(index int64) ([]byte, error) {
+	if page, ok := p.pages[index]; ok {
+		return page, nil
+	}
+	start := index * pagedReaderPage
+	if start >= p.size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	page := make([]byte, min(pagedReaderPage, p.size-start))
+	if _, err := p.r.ReadAt(page, start); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(p.order) == pagedReaderPages {
+		delete(p.pages, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.pages[index] = page
+	p.order = append(p.order, index)
+	return page, nil
+}
+
+func (p *pagedReader) read(off int64, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off+n > p.size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	out := make([]byte, 0, n)
+	for int64(len(out)) < n {
+		pos := off + int64(len(out))
+		page, err := p.page(pos / pagedReaderPage)
+		if err != nil {
+			return nil, err
+		}
+		chunk := page[pos%pagedReaderPage:]
+		out = append(out, chunk[:min(int64(len(chunk)), n-int64(len(out)))]...)
+	}
+	return out, nil
+}
+
+type msgKind int
+
+const (
+	msgNil msgKind = iota
+	msgBool
+	msgInt
+	msgUint
+	msgFloat
+	msgStr
+	msgBin
+	msgExt
+	msgArray
+	msgMap
+)
+
+// msgHeader describes the encoding of one msgpack value: its header size in
+// bytes, and either the payload length or, for arrays and maps, the number
+// of elements.
+type msgHeader struct {
+	kind   msgKind
+	size   int64
+	length int64
+	ext    int8
+}
+
+func (p *pagedReader) header(off int64) (msgHeader, error) {
+	b, err := p.read(off, 1)
+	if err != nil {
+		return msgHeader{}, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return msgHeader{kind: msgUint, size: 1}, nil
+	case c >= 0xe0:
+		return msgHeader{kind: msgInt, size: 1}, nil
+	case c&0xf0 == 0x80:
+		return msgHeader{kind: msgMap, size: 1, length: int64(c & 0x0f)}, nil
+	case c&0xf0 == 0x90:
+		return msgHeader{kind: msgArray, size: 1, length: int64(c & 0x0f)}, nil
+	case c&0xe0 == 0xa0:
+		return msgHeader{kind: msgStr, size: 1, length: int64(c & 0x1f)}, nil
+	}
+
+	sized := func(kind msgKind, width int64) (msgHeader, error) {
+		n, err := p.read(off+1, width)
+		if err != nil {
+			return msgHeader{}, err
+		}
+		var length uint64
+		for _, x := range n {
+			length = length<<8 | uint64(x)
+		}
+		return msgHeader{kind: kind, size: 1 + width, length: int64(length)}, nil
+	}
+	ext := func(size, length int64) (msgHeader, error) {
+		t, err := p.read(off+size-1, 1)
+		if err != nil {
+			return msgHeader{}, err
+		}
+		return msgHeader{kind: msgExt, size: size, length: length, ext: int8(t[0])}, nil
+	}
+
+	switch c {
+	case 0xc0:
+		return msgHeader{kind: msgNil, size: 1}, nil
+	case 0xc2, 0xc3:
+		return msgHeader{kind: msgBool, size: 1}, nil
+	case 0xc4, 0xc5, 0xc6:
+		return sized(msgBin, 1<<(c-0xc4))
+	case 0xc7, 0xc8, 0xc9:
+		h, err := sized(msgExt, 1<<(c-0xc7))
+		if err != nil {
+			return h, err
+		}
+		return ext(h.size+1, h.length)
+	case 0xca:
+		return msgHeader{kind: msgFloat, size: 1, length: 4}, nil
+	case 0xcb:
+		return msgHeader{kind: msgFloat, size: 1, length: 8}, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return msgHeader{kind: msgUint, size: 1, length: 1 << (c - 0xcc)}, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		return msgHeader{kind: msgInt, size: 1, length: 1 << (c - 0xd0)}, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return ext(2, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		return sized(msgStr, 1<<(c-0xd9))
+	case 0xdc, 0xdd:
+		return sized(msgArray, 2<<(c-0xdc))
+	case 0xde, 0xdf:
+		return sized(msgMap, 2<<(c-0xde))
+	}
+	return msgHeader{}, fmt.Errorf("invalid msgpack code 0x%02x at offset %d", c, off)
+}
+
+// skip returns the offset just past the value at off, reading only headers.
+func (p *pagedReader) skip(off int64) (int64, error) {
+	for pending := int64(1); pending > 0; pending-- {
+		h, err := p.header(off)
+		if err != nil {
+			return 0, err
+		}
+		off += h.size
+		switch h.kind {
+		case msgArray:
+			pending += h.length
+		case msgMap:
+			pending += 2 * h.length
+		default:
+			off += h.length
+		}
+		if off > p.size {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return off, nil
+}
+
+// decode fully decodes the value in [off, end).
+func (p *pagedReader) decode(off, end int64) (interface{}, error) {
+	data, err := p.read(off, end-off)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return normalizeValue(value), nil
+}
+
+// readKey decodes the map key at off and returns it with the offset of the
+// value that follows it.
+func (p *pagedReader) readKey(off int64) (string, int64, error) {
+	end, err := p.skip(off)
+	if err != nil {
+		return "", 0, err
+	}
+	if end-off > browseMaxScalar {
+		return fmt.Sprintf("<%d byte key>", end-off), end, nil
+	}
+	key, err := p.decode(off, end)
+	if err != nil {
+		return "", 0, err
+	}
+	return fmt.Sprint(key), end, nil
+}
+
+// lazyNode is one value in the browse tree. Children are read a page at a
+// time when the node is expanded.
+type lazyNode struct {
+	parent   *lazyNode
+	seg      pathSegment
+	offset   int64
+	end      int64
+	head     msgHeader
+	depth    int
+	children []*lazyNode
+	next     int64
+	expanded bool
+	// more is the placeholder row standing for children not loaded yet.
+	more        *lazyNode
+	placeholder bool
+}
+
+func (n *lazyNode) container() bool {
+	return n.head.kind == msgArray || n.head.kind == msgMap
+}
+
+func (n *lazyNode) path() []pathSegment {
+	if n.parent == nil {
+		return nil
+	}
+	return appendPath(n.parent.path(), n.seg)
+}
+
+func (n *lazyNode) label() string {
+	switch {
+	case n.parent == nil:
+		return "$"
+	case n.seg.isIndex:
+		return fmt.Sprintf("[%d]", n.seg.index)
+	case isPlainPathKey(n.seg.key):
+		return n.seg.key
+	default:
+		return strconv.Quote(n.seg.key)
+	}
+}
+
+type browseMode int
+
+const (
+	browseNormal browseMode = iota
+	browseSearch
+)
+
+// browser is the state of `mpt browse`. It is driven by key names through
+// press, so the terminal loop and tests share the same code path.
+type browser struct {
+	opts      options
+	doc       *pagedReader
+	root      *lazyNode
+	rows      []*lazyNode
+	cursor    int
+	top       int
+	width     int
+	height    int
+	mode      browseMode
+	input     string
+	query     string
+	message   string
+	clipboard string
+	out       io.Writer
+	quit      bool
+}
+
+func newBrowser(opts options, r io.ReaderAt, size int64) (*browser, error) {
+	doc := newPagedReader(r, size)
+	head, err := doc.header(0)
+	if err != nil {
+		return nil, fmt.Errorf("read msgpack header: %w", err)
+	}
+	// The root is not measured up front, which would mean reading the
+	// whole file.
+	root := &lazyNode{head: head, end: size, next: head.size}
+	b := &browser{opts: opts, doc: doc, root: root, width: 80, height: 24, out: io.Discard}
+	b.rebuild()
+	return b, nil
+}
+
+func (b *browser) loadChildren(n *lazyNode, upto int) error {
+	count := int(n.head.length)
+	for len(n.children) < min(upto, count) {
+		child := &lazyNode{parent: n, depth: n.depth + 1}
+		off := n.next
+		if n.head.kind == msgMap {
+			key, valueOff, err := b.doc.readKey(off)
+			if err != nil {
+				return err
+			}
+			child.seg = keySegment(key)
+			off = valueOff
+		} else {
+			child.seg = indexSegment(len(n.children))
+		}
+		head, err := b.doc.header(off)
+		if err != nil {
+			return err
+		}
+		end, err := b.doc.skip(off)
+		if err != nil {
+			return err
+		}
+		child.offset, child.head, child.end, child.next = off, head, end, off+head.size
+		n.children = append(n.children, child)
+		n.next = end
+	}
+	return nil
+}
+
+// rebuild flattens the expanded part of the tree into rows, keeping the
+// selected node selected.
+func (b *browser) rebuild() {
+	var selected *lazyNode
+	if b.cursor < len(b.rows) {
+		selected = b.rows[b.cursor]
+	}
+	b.rows = b.rows[:0]
+	var walk func(n *lazyNode)
+	walk = func(n *lazyNode) {
+		b.rows = append(b.rows, n)
+		if !n.expanded {
+			return
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+		if len(n.children) < int(n.head.length) {
+			if n.more == nil {
+				n.more = &lazyNode{parent: n, depth: n.depth + 1, placeholder: true}
+			}
+			b.rows = append(b.rows, n.more)
+		}
+	}
+	walk(b.root)
+	b.selectNode(selected)
+}
+
+func (b *browser) selectNode(n *lazyNode) {
+	for i, row := range b.rows {
+		if row == n {
+			b.cursor = i
+			return
+		}
+	}
+	b.cursor = min(b.cursor, len(b.rows)-1)
+}
+
+func (b *browser) expand(n *lazyNode) error {
+	if !n.container() || n.expanded {
+		return nil
+	}
+	if len(n.children) == 0 {
+		if err := b.loadChildren(n, browsePageSize); err != nil {
+			return err
+		}
+	}
+	n.expanded = true
+	b.rebuild()
+	return nil
+}
+
+func (b *browser) collapse(n *lazyNode) {
+	n.expanded = false
+	b.rebuild()
+}
+
+func (b *browser) loadMore(placeholder *lazyNode) error {
+	parent := placeholder.parent
+	loaded := len(parent.children)
+	if err := b.loadChildren(parent, loaded+browsePageSize); err != nil {
+		return err
+	}
+	b.rebuild()
+	if loaded < len(parent.children) {
+		b.selectNode(parent.children[loaded])
+	}
+	return nil
+}
+
+func (b *browser) treeHeight() int {
+	return max(b.height-2, 1)
+}
+
+func (b *browser) press(key string) {
+	if b.mode == browseSearch {
+		b.pressSearch(key)
+		return
+	}
+
+	b.message = ""
+	node := b.rows[b.cursor]
+	var err error
+	switch key {
+	case "up", "k":
+		b.cursor = max(b.cursor-1, 0)
+	case "down", "j":
+		b.cursor = min(b.cursor+1, len(b.rows)-1)
+	case "pgup":
+		b.cursor = max(b.cursor-b.treeHeight(), 0)
+	case "pgdn":
+		b.cursor = min(b.cursor+b.treeHeight(), len(b.rows)-1)
+	case "home", "g":
+		b.cursor = 0
+	case "end", "G":
+		b.cursor = len(b.rows) - 1
+	case "right", "l":
+		switch {
+		case node.placeholder:
+			err = b.loadMore(node)
+		case node.expanded && b.cursor+1 < len(b.rows):
+			b.cursor++
+		default:
+			err = b.expand(node)
+		}
+	case "enter", " ":
+		switch {
+		case node.placeholder:
+			err = b.loadMore(node)
+		case node.expanded:
+			b.collapse(node)
+		default:
+			err = b.expand(node)
+		}
+	case "left", "h":
+		if node.expanded {
+			b.collapse(node)
+		} else if node.parent != nil {
+			b.selectNode(node.parent)
+		}
+	case "/":
+		b.mode = browseSearch
+		b.input = ""
+	case "n":
+		err = b.search()
+	case "y":
+		b.copy(formatPath(b.selected().path()), "path")
+	case "Y":
+		err = b.copyJSON()
+	case "q", "ctrl-c":
+		b.quit = true
+	}
+	if err != nil {
+		b.message = "error: " + err.Error()
+	}
+}
+
+func (b *browser) pressSearch(key string) {
+	switch key {
+	case "enter":
+		b.mode = browseNormal
+		if b.input != "" {
+			b.query = b.input
+		}
+		if err := b.search(); err != nil {
+			b.message = "error: " + err.Error()
+		}
+	case "esc", "ctrl-c":
+		b.mode = browseNormal
+	case "backspace":
+		if b.input != "" {
+			_, size := utf8.DecodeLastRuneInString(b.input)
+			b.input = b.input[:len(b.input)-size]
+		}
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			b.input += key
+		}
+	}
+}
+
+// selected is the node the status line describes. For a placeholder row
+// that is the container it belongs to.
+func (b *browser) selected() *lazyNode {
+	node := b.rows[b.cursor]
+	if node.placeholder {
+		return node.parent
+	}
+	return node
+}
+
+func (b *browser) copy(text, what string) {
+	b.clipboard = text
+	// OSC 52 asks the terminal to put the text on the system clipboard.
+	fmt.Fprintf(b.out, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	b.message = fmt.Sprintf("copied %s (%s)", what, plural(len(text), "byte"))
+}
+
+func (b *browser) copyJSON() error {
+	node := b.selected()
+	if node.end-node.offset > browseMaxCopy {
+		return fmt.Errorf("subtree is %d bytes, too large to copy", node.end-node.offset)
+	}
+	data, err := b.doc.read(node.offset, node.end-node.offset)
+	if err != nil {
+		return err
+	}
+	opts := b.opts
+	opts.layout = nil
+	out, err := opts.transcode(data, FormatMsgpack, FormatJSON)
+	if err != nil {
+		return err
+	}
+	b.copy(string(out), "json")
+	return nil
+}
+
+// search finds the next key or scalar value containing the query after the
+// selected node, wrapping around at the end of the document.
+func (b *browser) search() error {
+	if b.query == "" {
+		return nil
+	}
+	after := b.selected().offset
+	path, found, err := b.scan(strings.ToLower(b.query), after)
+	if err == nil && !found {
+		path, found, err = b.scan(strings.ToLower(b.query), -1)
+		b.message = "search wrapped"
+	}
+	if err != nil {
+		return err
+	}
+	if !found {
+		b.message = fmt.Sprintf("%q not found", b.query)
+		return nil
+	}
+	return b.reveal(path)
+}
+
+type scanFrame struct {
+	isMap     bool
+	remaining int64
+	index     int
+	key       string
+	wantKey   bool
+}
+
+// scan walks the document in order without building nodes and returns the
+// path of the first match whose value starts after the given offset.
+func (b *browser) scan(query string, after int64) ([]pathSegment, bool, error) {
+	var stack []*scanFrame
+	path := func() []pathSegment {
+		segments := make([]pathSegment, len(stack))
+		for i, f := range stack {
+			if f.isMap {
+				segments[i] = keySegment(f.key)
+			} else {
+				segments[i] = indexSegment(f.index)
+			}
+		}
+		return segments
+	}
+	done := false
+	finish := func() {
+		for len(stack) > 0 {
+			f := stack[len(stack)-1]
+			f.remaining--
+			f.wantKey = f.isMap
+			f.index++
+			if f.remaining > 0 {
+				return
+			}
+			stack = stack[:len(stack)-1]
+		}
+		done = true
+	}
+
+	off := int64(0)
+	for !done {
+		if n := len(stack); n > 0 && stack[n-1].wantKey {
+			f := stack[n-1]
+			key, valueOff, err := b.doc.readKey(off)
+			if err != nil {
+				return nil, false, err
+			}
+			f.key, f.wantKey = key, false
+			if valueOff > after && strings.Contains(strings.ToLower(key), query) {
+				return path(), true, nil
+			}
+			off = valueOff
+			continue
+		}
+
+		h, err := b.doc.header(off)
+		if err != nil {
+			return nil, false, err
+		}
+		switch h.kind {
+		case msgArray, msgMap:
+			off += h.size
+			if h.length == 0 {
+				finish()
+				continue
+			}
+			stack = append(stack, &scanFrame{isMap: h.kind == msgMap, remaining: h.length, wantKey: h.kind == msgMap})
+		default:
+			if off > after && h.kind != msgBin && h.kind != msgExt && h.length <= browseMaxSearch {
+				value, err := b.doc.decode(off, off+h.size+h.length)
+				if err != nil {
+					return nil, false, err
+				}
+				if strings.Contains(strings.ToLower(fmt.Sprint(value)), query) {
+					return path(), true, nil
+				}
+			}
+			off += h.size + h.length
+			finish()
+		}
+	}
+	return nil, false, nil
+}
+
+// reveal expands the ancestors of path, loading children as needed, and
+// selects the node at path.
+func (b *browser) reveal(path []pathSegment) error {
+	node := b.root
+	for _, seg := range path {
+		if len(node.children) == 0 {
+			if err := b.loadChildren(node, browsePageSize); err != nil {
+				return err
+			}
+		}
+		node.expanded = true
+		var next *lazyNode
+		for next == nil {
+			for _, child := range node.children {
+				if child.seg == seg {
+					next = child
+					break
+				}
+			}
+			if next != nil {
+				break
+			}
+			if len(node.children) >= int(node.head.length) {
+				return fmt.Errorf("%s not found", formatPath(path))
+			}
+			if err := b.loadChildren(node, len(node.children)+browsePageSize); err != nil {
+				return err
+			}
+		}
+		node = next
+	}
+	b.rebuild()
+	b.selectNode(node)
+	return nil
+}
+
+func containerSummary(isMap bool, count int64, collapsed bool) string {
+	ellipsis := ""
+	if collapsed {
+		ellipsis = "…"
+	}
+	switch {
+	case isMap && count == 0:
+		return "{}"
+	case isMap:
+		return fmt.Sprintf("{%s%s}", ellipsis, plural(int(count), "key"))
+	case count == 0:
+		return "[]"
+	default:
+		return fmt.Sprintf("[%s%s]", ellipsis, plural(int(count), "item"))
+	}
+}
+
+func (b *browser) rowText(n *lazyNode) string {
+	indent := strings.Repeat("  ", n.depth)
+	if n.placeholder {
+		rest := int(n.parent.head.length) - len(n.parent.children)
+		return fmt.Sprintf("%s  … %s not loaded, enter to load", indent, plural(rest, "more item"))
+	}
+
+	marker := "  "
+	if n.container() && n.head.length > 0 {
+		marker = "▸ "
+		if n.expanded {
+			marker = "▾ "
+		}
+	}
+	return indent + marker + n.label() + ": " + b.summary(n)
+}
+
+func (b *browser) summary(n *lazyNode) string {
+	if n.container() {
+		return containerSummary(n.head.kind == msgMap, n.head.length, !n.expanded)
+	}
+	size := n.end - n.offset
+	if size > browseMaxScalar {
+		prefix, err := b.doc.read(n.offset+n.head.size, min(n.head.length, treeMaxString))
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		if n.head.kind == msgStr {
+			return fmt.Sprintf("%s… (%s)", strconv.Quote(strings.ToValidUTF8(string(prefix), "")), plural(int(n.head.length), "byte"))
+		}
+		return fmt.Sprintf("<%s %s> %s…", kindName(n.head), plural(int(n.head.length), "byte"), hex.EncodeToString(prefix[:min(len(prefix), treeMaxBytes)]))
+	}
+	value, err := b.doc.decode(n.offset, n.end)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	text, err := (&treeRenderer{opts: b.opts}).scalar(value)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return text
+}
+
+func kindName(h msgHeader) string {
+	switch h.kind {
+	case msgBin:
+		return "bin"
+	case msgExt:
+		return "ext " + strconv.Itoa(int(h.ext))
+	default:
+		return "str"
+	}
+}
+
+// screen renders the current frame as plain lines: the visible rows, a
+// status line and a key or prompt line.
+func (b *browser) screen() []string {
+	height := b.treeHeight()
+	if b.cursor < b.top {
+		b.top = b.cursor
+	}
+	if b.cursor >= b.top+height {
+		b.top = b.cursor - height + 1
+	}
+
+	lines := make([]string, 0, b.height)
+	for i := b.top; i < len(b.rows) && i < b.top+height; i++ {
+		lines = append(lines, b.fit(b.rowText(b.rows[i])))
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+
+	node := b.selected()
+	status := fmt.Sprintf("%s  offset %d (0x%x)  size %s", formatPath(node.path()), node.offset, node.offset, plural(int(node.end-node.offset), "byte"))
+	if b.message != "" {
+		status += "  " + b.message
+	}
+	lines = append(lines, b.fit(status))
+
+	if b.mode == browseSearch {
+		lines = append(lines, b.fit("/"+b.input))
+	} else {
+		lines = append(lines, b.fit("↑↓ move  → expand  ← collapse  / search  n next  y copy path  Y copy json  q quit"))
+	}
+	return lines
+}
+
+func (b *browser) fit(line string) string {
+	if utf8.RuneCountInString(line) <= b.width {
+		return line
+	}
+	return string([]rune(line)[:max(b.width-1, 0)]) + "…"
+}
+
+// draw writes a full frame, highlighting the selected row.
+func (b *browser) draw(w io.Writer) {
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	for i, line := range b.screen() {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("\x1b[2K")
+		if i == b.cursor-b.top {
+			buf.WriteString("\x1b[7m" + line + colorReset)
+		} else {
+			buf.WriteString(line)
+		}
+	}
+	w.Write(buf.Bytes())
+}
+
+// readKey reads one key press and names it, decoding the escape sequences
+// terminals send for arrows and paging keys.
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	case '\t':
+		return "tab", nil
+	case 0x1b:
+	default:
+		return string(c), nil
+	}
+
+	if r.Buffered() == 0 {
+		return "esc", nil
+	}
+	next, _ := r.ReadByte()
+	if next != '[' && next != 'O' {
+		return "esc", nil
+	}
+	var seq []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "esc", nil
+		}
+		seq = append(seq, b)
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	switch string(seq) {
+	case "A":
+		return "up", nil
+	case "B":
+		return "down", nil
+	case "C":
+		return "right", nil
+	case "D":
+		return "left", nil
+	case "H", "1~":
+		return "home", nil
+	case "F", "4~":
+		return "end", nil
+	case "5~":
+		return "pgup", nil
+	case "6~":
+		return "pgdn", nil
+	}
+	return "esc", nil
+}
+
+// run reads keys from in until quit or end of input, redrawing after each.
+// size, when set, is polled for the terminal dimensions.
+func (b *browser) run(in io.Reader, out io.Writer, size func() (int, int)) error {
+	b.out = out
+	keys := bufio.NewReader(in)
+	for !b.quit {
+		if size != nil {
+			b.width, b.height = size()
+		}
+		b.draw(out)
+		key, err := readKey(keys)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.press(key)
+	}
+	return nil
+}
+
+// browseFile opens a file in the interactive browser. Msgpack files are read
+// lazily; other formats and text encodings are converted to msgpack in
+// memory first, and offsets then refer to that encoding.
+func (o options) browseFile(inputPath string) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return fmt.Errorf("browse needs an interactive terminal")
+	}
+	fromFormat, err := o.resolveFromFormat(inputPath)
+	if err != nil {
+		return err
+	}
+
+	compressed, err := o.inputCompressed(inputPath)
+	if err != nil {
+		return err
+	}
+
+	var r io.ReaderAt
+	var size int64
+	if fromFormat == FormatMsgpack && o.inputEnc == EncodingNone && !compressed {
+		f, err := os.Open(inputPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		r, size = f, info.Size()
+	} else {
+		converted, err := o.readAndConvert(inputPath, fromFormat, FormatMsgpack)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(converted), int64(len(converted))
+	}
+
+	b, err := newBrowser(o, r, size)
+	if err != nil {
+		return fmt.Errorf("browse %s: %w", inputPath, err)
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	return b.run(os.Stdin, os.Stdout, func() (int, int) {
+		w, h, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			return 80, 24
+		}
+		return w, h
+	})
+}
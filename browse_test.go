@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// browseScript runs the browser over data with raw terminal input and
+// returns it for inspection.
+func browseScript(t *testing.T, data []byte, input string) *browser {
+	t.Helper()
+	b, err := newBrowser(options{}, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("newBrowser failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := b.run(strings.NewReader(input), &out, func() (int, int) { return 80, 12 }); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	return b
+}
+
+func TestBrowse(t *testing.T) {
+	items := make([]interface{}, 150)
+	for i := range items {
+		items[i] = map[string]interface{}{"sku": i}
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(map[string]interface{}{"items": items, "name": "needle in here"}); err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+	data := buf.Bytes()
+
+	const (
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		right = "\x1b[C"
+		left  = "\x1b[D"
+	)
+
+	b := browseScript(t, data, right+down+right+down)
+	screen := b.screen()
+	if screen[0] != "▾ $: {2 keys}" || screen[1] != "  ▾ items: [150 items]" {
+		t.Errorf("unexpected screen:\n%s", strings.Join(screen, "\n"))
+	}
+	if got := b.selected(); formatPath(got.path()) != "$.items[0]" || got.offset != 10 {
+		t.Errorf("selected %s at offset %d", formatPath(got.path()), got.offset)
+	}
+	if !strings.HasPrefix(screen[len(screen)-2], "$.items[0]  offset 10 (0xa)  size 6 bytes") {
+		t.Errorf("unexpected status line %q", screen[len(screen)-2])
+	}
+
+	b = browseScript(t, data, right+down+right+"G"+up+"\r")
+	if got := formatPath(b.selected().path()); got != "$.items[100]" {
+		t.Errorf("loading more selected %s", got)
+	}
+
+	b = browseScript(t, data, "/sku\r")
+	if got := formatPath(b.selected().path()); got != "$.items[0].sku" {
+		t.Errorf("key search selected %s", got)
+	}
+	b = browseScript(t, data, "/NEEDLE\rn")
+	if got := formatPath(b.selected().path()); got != "$.name" || b.message != "search wrapped" {
+		t.Errorf("value search selected %s with message %q", got, b.message)
+	}
+	b = browseScript(t, data, "/sku\r/149\r"+left)
+	if got := formatPath(b.selected().path()); got != "$.items[149]" {
+		t.Errorf("search past the loaded page then left selected %s", got)
+	}
+
+	b = browseScript(t, data, right+down+right+down+"yY")
+	if b.clipboard != `{
+  "sku": 0
+}` {
+		t.Errorf("unexpected clipboard %q", b.clipboard)
+	}
+
+	b = browseScript(t, data, "q"+down)
+	if !b.quit || b.cursor != 0 {
+		t.Error("q should stop reading keys")
+	}
+}
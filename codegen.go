@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func runCodegen(args []string) error {
+	opts, err := parseCodegenArgs(args)
+	if err != nil {
+		return err
+	}
+
+	samples, err := loadSamples(opts)
+	if err != nil {
+		return err
+	}
+
+	code, err := generateCode(inferSchema(samples), opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.output == "" {
+		_, err = os.Stdout.Write(code)
+		return err
+	}
+	if err := writeFileAtomic(opts.output, code, false); err != nil {
+		return fmt.Errorf("write %s: %w", opts.output, err)
+	}
+	return nil
+}
+
+func parseCodegenArgs(args []string) (codegenOptions, error) {
+	opts := codegenOptions{pkg: "models"}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.inputs = append(opts.inputs, args[i+1:]...)
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			if opts.lang == "" {
+				opts.lang = arg
+			} else {
+				opts.inputs = append(opts.inputs, arg)
+			}
+			continue
+		}
+
+		switch arg {
+		case "-h", "--help":
+			return opts, errHelp
+		case "--typeddict":
+			opts.typedDict = true
+		case "--package", "--type", "--from", "-o", "--output":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires a value: %w", arg, errUsage)
+			}
+			value := args[i+1]
+			i++
+			switch arg {
+			case "--package":
+				opts.pkg = value
+			case "--type":
+				opts.typeName = value
+			case "--from":
+				format, err := parseFormat(value)
+				if err != nil {
+					return opts, err
+				}
+				opts.from = format
+			default:
+				opts.output = value
+			}
+		default:
+			return opts, fmt.Errorf("unknown codegen flag %q: %w", arg, errUsage)
+		}
+	}
+
+	switch opts.lang {
+	case "":
+		return opts, fmt.Errorf("codegen requires a target language: %w", errUsage)
+	case "go", "ts", "python", "rust":
+	case "typescript":
+		opts.lang = "ts"
+	case "py":
+		opts.lang = "python"
+	case "rs":
+		opts.lang = "rust"
+	default:
+		return opts, fmt.Errorf("unsupported codegen language %q: %w", opts.lang, errUsage)
+	}
+	if len(opts.inputs) == 0 {
+		return opts, fmt.Errorf("codegen requires at least one sample file: %w", errUsage)
+	}
+	if opts.typedDict && opts.lang != "python" {
+		return opts, fmt.Errorf("--typeddict only applies to python: %w", errUsage)
+	}
+	if opts.typeName == "" {
+		base := filepath.Base(opts.inputs[0])
+		opts.typeName = pascalCase(strings.TrimSuffix(base, filepath.Ext(base)), opts.lang == "go")
+	}
+
+	return opts, nil
+}
+
+// loadSamples decodes every input file. A file whose top level is an array of
+// objects contributes each element as a separate sample, so feed dumps can be
+// used directly.
+func loadSamples(opts codegenOptions) ([]interface{}, error) {
+	var samples []interface{}
+	for _, input := range opts.inputs {
+		fromFormat := opts.from
+		if fromFormat == FormatUnknown {
+			detected, err := detectFormat(input)
+			if err != nil {
+				return nil, err
+			}
+			fromFormat = detected
+		}
+
+		data, err := options{}.readInput(input)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decodeData(data, fromFormat)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+
+		if items, ok := value.([]interface{}); ok && allObjects(items) {
+			samples = append(samples, items...)
+			continue
+		}
+		samples = append(samples, value)
+	}
+	return samples, nil
+}
+
+func allObjects(items []interface{}) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func generateCode(schema *schemaNode, opts codegenOptions) ([]byte, error) {
+	if schema.kind() != kindObject {
+		return nil, fmt.Errorf("codegen needs samples whose top level is an object")
+	}
+
+	switch opts.lang {
+	case "go":
+		return generateGo(schema, opts.pkg, opts.typeName)
+	case "ts":
+		return generateTypeScript(schema, opts.typeName)
+	case "python":
+		return generatePython(schema, opts.typeName, opts.typedDict)
+	case "rust":
+		return generateRust(schema, opts.typeName)
+	default:
+		return nil, fmt.Errorf("unsupported codegen language %q", opts.lang)
+	}
+}
+
+// goGenerator emits one struct per object position, naming nested structs
+// after their parent type and field.
+type goGenerator struct {
+	names   typeNamer
+	decls   []string
+	imports map[string]bool
+	err     error
+}
+
+func generateGo(schema *schemaNode, pkg, typeName string) ([]byte, error) {
+	g := &goGenerator{names: typeNamer{}, imports: make(map[string]bool)}
+	g.structType(typeName, schema)
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// Code generated by mpt codegen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&sb, "package %s\n\n", pkg)
+	if g.imports["time"] {
+		sb.WriteString("import \"time\"\n\n")
+	}
+	sb.WriteString(strings.Join(g.decls, "\n"))
+
+	code, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("format generated go: %w", err)
+	}
+	return code, nil
+}
+
+func (g *goGenerator) structType(name string, n *schemaNode) string {
+	name = g.names.unique(name)
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "type %s struct {\n", name)
+	fieldNames := typeNamer{}
+	for _, key := range n.fieldNames() {
+		field := n.fields[key]
+		goName := fieldNames.unique(pascalCase(key, true))
+
+		typ := g.goType(field, name+goName)
+		if err := checkGoTagKey(key); err != nil && g.err == nil {
+			g.err = err
+		}
+		tag := key
+		if field.optional(n) {
+			tag += ",omitempty"
+			if goPointerable(field) {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(&sb, "\t%s %s %s\n", goName, typ, goTag(tag))
+	}
+	sb.WriteString("}\n")
+
+	g.decls[index] = sb.String()
+	return name
+}
+
+// goTag writes a struct tag as a raw string, or as an interpreted string
+// when a key holds a backtick or a character a raw string cannot.
+func goTag(name string) string {
+	tag := fmt.Sprintf("msgpack:%s json:%s", strconv.Quote(name), strconv.Quote(name))
+	if strconv.CanBackquote(tag) {
+		return "`" + tag + "`"
+	}
+	return strconv.Quote(tag)
+}
+
+// checkGoTagKey refuses keys that struct tags cannot name: the encoders
+// read a comma as the start of the options, "-" as skip, and an empty name
+// as the field's own name.
+func checkGoTagKey(key string) error {
+	switch {
+	case key == "" || key == "-":
+		return fmt.Errorf("key %q cannot be named in a go struct tag", key)
+	case strings.Contains(key, ","):
+		return fmt.Errorf("key %q cannot be named in a go struct tag because it contains a comma", key)
+	}
+	return nil
+}
+
+func (g *goGenerator) goType(n *schemaNode, hint string) string {
+	switch n.kind() {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int64"
+	case kindUint:
+		return "uint64"
+	case kindFloat:
+		return "float64"
+	case kindString:
+		return "string"
+	case kindBytes:
+		return "[]byte"
+	case kindTime:
+		g.imports["time"] = true
+		return "time.Time"
+	case kindArray:
+		if n.elem == nil || n.elem.seen == n.elem.nulls {
+			return "[]interface{}"
+		}
+		elem := g.goType(n.elem, singular(hint))
+		if n.elem.nullable() && goPointerable(n.elem) {
+			elem = "*" + elem
+		}
+		return "[]" + elem
+	case kindObject:
+		if len(n.fields) == 0 {
+			return "map[string]interface{}"
+		}
+		return g.structType(hint, n)
+	default:
+		return "interface{}"
+	}
+}
+
+// goPointerable reports whether an optional value of this kind needs a
+// pointer to tell absence apart from the zero value.
+func goPointerable(n *schemaNode) bool {
+	switch n.kind() {
+	case kindBool, kindInt, kindUint, kindFloat, kindString, kindTime:
+		return true
+	case kindObject:
+		return len(n.fields) > 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var pythonIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var pythonKeywords = map[string]bool{
+	"False": true, "None": true, "True": true, "and": true, "as": true, "assert": true,
+	"async": true, "await": true, "break": true, "class": true, "continue": true, "def": true,
+	"del": true, "elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true, "is": true,
+	"lambda": true, "nonlocal": true, "not": true, "or": true, "pass": true, "raise": true,
+	"return": true, "try": true, "while": true, "with": true, "yield": true,
+}
+
+// pythonGenerator emits dataclasses, or TypedDicts when the decoded dicts
+// are used directly, with bin as bytes and timestamps as datetime.
+type pythonGenerator struct {
+	names     typeNamer
+	decls     []string
+	typedDict bool
+	imports   map[string]bool
+	typing    map[string]bool
+}
+
+func generatePython(schema *schemaNode, typeName string, typedDict bool) ([]byte, error) {
+	g := &pythonGenerator{
+		names:     typeNamer{},
+		typedDict: typedDict,
+		imports:   make(map[string]bool),
+		typing:    make(map[string]bool),
+	}
+	g.classType(typeName, schema)
+
+	var sb strings.Builder
+	sb.WriteString("# Code generated by mpt codegen; DO NOT EDIT.\n\n")
+	sb.WriteString("from __future__ import annotations\n\n")
+	if !typedDict {
+		sb.WriteString("from dataclasses import dataclass\n")
+	}
+	if g.imports["datetime"] {
+		sb.WriteString("from datetime import datetime\n")
+	}
+	if typedDict {
+		g.typing["TypedDict"] = true
+	}
+	if len(g.typing) > 0 {
+		var names []string
+		for _, name := range []string{"Any", "NotRequired", "Optional", "TypedDict"} {
+			if g.typing[name] {
+				names = append(names, name)
+			}
+		}
+		fmt.Fprintf(&sb, "from typing import %s\n", strings.Join(names, ", "))
+	}
+	sb.WriteString("\n\n")
+	sb.WriteString(strings.Join(g.decls, "\n\n"))
+	return []byte(sb.String()), nil
+}
+
+func (g *pythonGenerator) classType(name string, n *schemaNode) string {
+	name = g.names.unique(name)
+
+	var required, optional []string
+	validKeys := true
+	for _, key := range n.fieldNames() {
+		if !pythonIdentifier.MatchString(key) || pythonKeywords[key] {
+			validKeys = false
+		}
+	}
+
+	fieldNames := typeNamer{}
+	for _, key := range n.fieldNames() {
+		field := n.fields[key]
+		typ := g.pyType(field, name+pascalCase(key, false))
+		if field.nullable() && field.kind() != kindNull {
+			g.typing["Optional"] = true
+			typ = "Optional[" + typ + "]"
+		}
+		missing := field.seen < n.objects
+
+		switch {
+		case g.typedDict && validKeys:
+			if missing {
+				g.typing["NotRequired"] = true
+				typ = "NotRequired[" + typ + "]"
+			}
+			required = append(required, fmt.Sprintf("    %s: %s", key, typ))
+		case g.typedDict:
+			if missing {
+				g.typing["NotRequired"] = true
+				typ = "NotRequired[" + typ + "]"
+			}
+			required = append(required, fmt.Sprintf("    %s: %s,", pythonQuote(key), typ))
+		default:
+			attr := fieldNames.unique(pythonAttribute(key))
+			comment := ""
+			if attr != key {
+				comment = "  # " + pythonQuote(key)
+			}
+			if missing || field.nullable() {
+				if !strings.HasPrefix(typ, "Optional[") && typ != "None" {
+					g.typing["Optional"] = true
+					typ = "Optional[" + typ + "]"
+				}
+				optional = append(optional, fmt.Sprintf("    %s: %s = None%s", attr, typ, comment))
+			} else {
+				required = append(required, fmt.Sprintf("    %s: %s%s", attr, typ, comment))
+			}
+		}
+	}
+
+	var sb strings.Builder
+	switch {
+	case g.typedDict && !validKeys:
+		fmt.Fprintf(&sb, "%s = TypedDict(\n    %s,\n    {\n", name, pythonQuote(name))
+		for _, line := range required {
+			sb.WriteString("    " + line + "\n")
+		}
+		sb.WriteString("    },\n)\n")
+	case g.typedDict:
+		fmt.Fprintf(&sb, "class %s(TypedDict):\n", name)
+	default:
+		fmt.Fprintf(&sb, "@dataclass\nclass %s:\n", name)
+	}
+	if !g.typedDict || validKeys {
+		lines := append(required, optional...)
+		if len(lines) == 0 {
+			lines = []string{"    pass"}
+		}
+		sb.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+
+	// Nested classes are appended first: the functional TypedDict form
+	// evaluates its field types when the module is imported.
+	g.decls = append(g.decls, sb.String())
+	return name
+}
+
+func (g *pythonGenerator) pyType(n *schemaNode, hint string) string {
+	switch n.kind() {
+	case kindBool:
+		return "bool"
+	case kindInt, kindUint:
+		return "int"
+	case kindFloat:
+		return "float"
+	case kindString:
+		return "str"
+	case kindBytes:
+		return "bytes"
+	case kindTime:
+		g.imports["datetime"] = true
+		return "datetime"
+	case kindArray:
+		if n.elem == nil || n.elem.seen == n.elem.nulls {
+			g.typing["Any"] = true
+			return "list[Any]"
+		}
+		elem := g.pyType(n.elem, singular(hint))
+		if n.elem.nullable() {
+			g.typing["Optional"] = true
+			elem = "Optional[" + elem + "]"
+		}
+		return "list[" + elem + "]"
+	case kindObject:
+		if len(n.fields) == 0 {
+			g.typing["Any"] = true
+			return "dict[str, Any]"
+		}
+		return g.classType(hint, n)
+	case kindNull:
+		return "None"
+	default:
+		g.typing["Any"] = true
+		return "Any"
+	}
+}
+
+func pythonAttribute(key string) string {
+	name := snakeCase(key)
+	if pythonKeywords[name] {
+		name += "_"
+	}
+	return name
+}
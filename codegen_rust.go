@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var rustKeywords = map[string]bool{
+	"as": true, "async": true, "await": true, "break": true, "const": true, "continue": true,
+	"crate": true, "dyn": true, "self": true, "Self": true, "else": true, "enum": true,
+	"extern": true, "false": true, "fn": true, "for": true, "if": true, "impl": true, "in": true,
+	"let": true, "loop": true, "match": true, "mod": true, "move": true, "mut": true, "pub": true,
+	"ref": true, "return": true, "static": true, "struct": true, "super": true, "trait": true,
+	"true": true, "type": true, "unsafe": true, "use": true, "where": true, "while": true,
+	"abstract": true, "become": true, "box": true, "do": true, "final": true, "macro": true,
+	"override": true, "priv": true, "try": true, "typeof": true, "unsized": true, "virtual": true,
+	"yield": true,
+}
+
+// rustGenerator emits serde structs for use with rmp-serde. Bin values use
+// serde_bytes::ByteBuf so they stay bin on the wire, and timestamps use the
+// ext struct convention rmp-serde understands.
+type rustGenerator struct {
+	names     typeNamer
+	decls     []string
+	timestamp bool
+	hashMap   bool
+}
+
+const rustTimestamp = `/// A msgpack timestamp (ext type -1) as raw ext bytes.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(rename = "_ExtStruct")]
+pub struct Timestamp(pub (i8, serde_bytes::ByteBuf));
+`
+
+func generateRust(schema *schemaNode, typeName string) ([]byte, error) {
+	g := &rustGenerator{names: typeNamer{}}
+	g.structType(typeName, schema)
+	if g.timestamp {
+		g.decls = append(g.decls, rustTimestamp)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("// Code generated by mpt codegen; DO NOT EDIT.\n\n")
+	if g.hashMap {
+		sb.WriteString("use std::collections::HashMap;\n\n")
+	}
+	sb.WriteString("use serde::{Deserialize, Serialize};\n\n")
+	sb.WriteString(strings.Join(g.decls, "\n"))
+	return []byte(sb.String()), nil
+}
+
+func (g *rustGenerator) structType(name string, n *schemaNode) string {
+	name = g.names.unique(name)
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var sb strings.Builder
+	sb.WriteString("#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]\n")
+	fmt.Fprintf(&sb, "pub struct %s {\n", name)
+	fieldNames := typeNamer{}
+	for _, key := range n.fieldNames() {
+		field := n.fields[key]
+		typ := g.rustType(field, name+pascalCase(key, false))
+		ident := fieldNames.unique(rustField(key))
+
+		var attrs []string
+		if strings.TrimPrefix(ident, "r#") != key {
+			attrs = append(attrs, "rename = "+rustQuote(key))
+		}
+		if field.optional(n) {
+			typ = "Option<" + typ + ">"
+			attrs = append(attrs, "default", `skip_serializing_if = "Option::is_none"`)
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, "    #[serde(%s)]\n", strings.Join(attrs, ", "))
+		}
+		fmt.Fprintf(&sb, "    pub %s: %s,\n", ident, typ)
+	}
+	sb.WriteString("}\n")
+
+	g.decls[index] = sb.String()
+	return name
+}
+
+func (g *rustGenerator) rustType(n *schemaNode, hint string) string {
+	switch n.kind() {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "i64"
+	case kindUint:
+		return "u64"
+	case kindFloat:
+		return "f64"
+	case kindString:
+		return "String"
+	case kindBytes:
+		return "serde_bytes::ByteBuf"
+	case kindTime:
+		g.timestamp = true
+		return "Timestamp"
+	case kindArray:
+		if n.elem == nil || n.elem.seen == n.elem.nulls {
+			return "Vec<rmpv::Value>"
+		}
+		elem := g.rustType(n.elem, singular(hint))
+		if n.elem.nullable() {
+			elem = "Option<" + elem + ">"
+		}
+		return "Vec<" + elem + ">"
+	case kindObject:
+		if len(n.fields) == 0 {
+			g.hashMap = true
+			return "HashMap<String, rmpv::Value>"
+		}
+		return g.structType(hint, n)
+	default:
+		return "rmpv::Value"
+	}
+}
+
+func rustField(key string) string {
+	name := snakeCase(key)
+	if rustKeywords[name] {
+		if name == "self" || name == "super" || name == "crate" {
+			return name + "_"
+		}
+		return "r#" + name
+	}
+	return name
+}
+
+// rustQuote writes a Rust string literal. Go's %q escapes like \u00a0 and
+// \a are not valid Rust, which spells them \u{a0} and \x07.
+func rustQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&sb, `\u{%x}`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
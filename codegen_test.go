@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func writeSample(t *testing.T, path string, value interface{}) {
+	t.Helper()
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		t.Fatalf("failed to marshal sample: %v", err)
+	}
+	writeTestFile(t, path, data)
+}
+
+func TestCodegenGo(t *testing.T) {
+	dir := setupTestDir(t)
+
+	first := filepath.Join(dir, "event1.msgpack")
+	second := filepath.Join(dir, "event2.msgpack")
+	writeSample(t, first, map[string]interface{}{
+		"id":       int64(1),
+		"user_id":  uint64(1 << 63),
+		"payload":  []byte{0x01},
+		"sent_at":  time.Unix(1700000000, 0),
+		"items":    []interface{}{map[string]interface{}{"sku": "a", "qty": int8(1)}},
+		"ratio":    int64(1),
+		"comment":  "hello",
+		"location": map[string]interface{}{"lat": 1.5, "lng": 2.5},
+	})
+	writeSample(t, second, map[string]interface{}{
+		"id":      int64(-2),
+		"user_id": uint64(3),
+		"payload": []byte{0x02},
+		"sent_at": time.Unix(1700000001, 0),
+		"items":   []interface{}{map[string]interface{}{"sku": "b", "price": 2.5}},
+		"ratio":   0.5,
+		"comment": nil,
+	})
+
+	opts, err := parseCodegenArgs([]string{"go", first, second, "--package", "feeds", "--type", "Event"})
+	if err != nil {
+		t.Fatalf("parseCodegenArgs failed: %v", err)
+	}
+	samples, err := loadSamples(opts)
+	if err != nil {
+		t.Fatalf("loadSamples failed: %v", err)
+	}
+	code, err := generateCode(inferSchema(samples), opts)
+	if err != nil {
+		t.Fatalf("generateCode failed: %v", err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "event.go", code, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+
+	for _, want := range []string{
+		"package feeds",
+		`import "time"`,
+		"type Event struct",
+		"ID       int64",
+		"UserID   uint64",
+		"Payload  []byte",
+		"SentAt   time.Time",
+		"Ratio    float64",
+		"Items    []EventItem",
+		"Comment  *string        `msgpack:\"comment,omitempty\" json:\"comment,omitempty\"`",
+		"Location *EventLocation `msgpack:\"location,omitempty\" json:\"location,omitempty\"`",
+		"type EventItem struct",
+		"Qty   *int64",
+		"Sku   string   `msgpack:\"sku\" json:\"sku\"`",
+	} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected generated code to contain %q, got:\n%s", want, code)
+		}
+	}
+}
+
+func TestCodegenGoTagKeys(t *testing.T) {
+	schema := inferSchema([]interface{}{map[string]interface{}{"a`b": int64(1), `q"x`: int64(2)}})
+	code, err := generateCode(schema, codegenOptions{lang: "go", pkg: "models", typeName: "Event"})
+	if err != nil {
+		t.Fatalf("generateCode failed: %v", err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "event.go", code, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, code)
+	}
+
+	var keys []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		if field, ok := n.(*ast.Field); ok && field.Tag != nil {
+			tag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				t.Fatalf("bad tag %s: %v", field.Tag.Value, err)
+			}
+			keys = append(keys, reflect.StructTag(tag).Get("msgpack"), reflect.StructTag(tag).Get("json"))
+		}
+		return true
+	})
+	want := []string{"a`b", "a`b", `q"x`, `q"x`}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("tags name keys %q, want %q", keys, want)
+	}
+
+	for _, key := range []string{"c,omitempty", "-", ""} {
+		schema := inferSchema([]interface{}{map[string]interface{}{key: int64(1)}})
+		_, err := generateCode(schema, codegenOptions{lang: "go", pkg: "models", typeName: "Event"})
+		assertError(t, err, fmt.Sprintf("key %q cannot be named", key))
+	}
+}
+
+func TestRustQuote(t *testing.T) {
+	cases := map[string]string{
+		"plain":          `"plain"`,
+		"x\u00a0y":       `"x\u{a0}y"`,
+		"bell\a\v\f":     `"bell\x07\x0b\x0c"`,
+		"tab\t\"q\"\\":   `"tab\t\"q\"\\"`,
+		"nul\x00\x7f":    `"nul\x00\x7f"`,
+		"wide\U000e0001": `"wide\u{e0001}"`,
+		"caf\u00e9":      `"café"`,
+	}
+	for in, want := range cases {
+		if got := rustQuote(in); got != want {
+			t.Errorf("rustQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+
+	schema := inferSchema([]interface{}{map[string]interface{}{"x\u00a0y": int64(1)}})
+	code, err := generateCode(schema, codegenOptions{lang: "rust", typeName: "Event"})
+	if err != nil {
+		t.Fatalf("rust codegen failed: %v", err)
+	}
+	if want := `#[serde(rename = "x\u{a0}y")]`; !strings.Contains(string(code), want) {
+		t.Errorf("expected rust code to contain %s, got:\n%s", want, code)
+	}
+}
+
+func TestCodegenArgs(t *testing.T) {
+	_, err := parseCodegenArgs([]string{"cobol", "file.msgpack"})
+	assertError(t, err, "unsupported codegen language")
+
+	_, err = parseCodegenArgs([]string{"go"})
+	assertError(t, err, "at least one sample")
+
+	opts, err := parseCodegenArgs([]string{"go", "dir/user_events.msgpack"})
+	if err != nil {
+		t.Fatalf("parseCodegenArgs failed: %v", err)
+	}
+	if opts.typeName != "UserEvents" || opts.pkg != "models" {
+		t.Errorf("unexpected defaults: type %q, package %q", opts.typeName, opts.pkg)
+	}
+}
+
+func TestCodegenOtherLanguages(t *testing.T) {
+	samples := []interface{}{
+		map[string]interface{}{"userId": int64(1), "blob": []byte{1}, "sentAt": time.Unix(0, 0), "type": "a", "tags": []interface{}{"x"}, "self": "me"},
+		map[string]interface{}{"userId": int64(2), "blob": []byte{2}, "sentAt": time.Unix(1, 0), "note": nil},
+	}
+	schema := inferSchema(samples)
+
+	cases := map[string][]string{
+		"ts": {
+			"export interface Event {",
+			"  blob: Uint8Array;",
+			"  sentAt: Date;",
+			"  tags?: string[];",
+			"  note?: null;",
+			"  userId: number;",
+		},
+		"python": {
+			"@dataclass\nclass Event:",
+			"    blob: bytes",
+			"    sent_at: datetime  # \"sentAt\"",
+			"    tags: Optional[list[str]] = None",
+			"    type: Optional[str] = None",
+			"from datetime import datetime",
+		},
+		"rust": {
+			"pub struct Event {",
+			"    pub blob: serde_bytes::ByteBuf,",
+			"    #[serde(rename = \"sentAt\")]\n    pub sent_at: Timestamp,",
+			"    pub r#type: Option<String>,",
+			"    #[serde(rename = \"self\", default, skip_serializing_if = \"Option::is_none\")]\n    pub self_: Option<String>,",
+			"    #[serde(rename = \"userId\")]\n    pub user_id: i64,",
+			"pub struct Timestamp(pub (i8, serde_bytes::ByteBuf));",
+		},
+	}
+	for lang, wants := range cases {
+		code, err := generateCode(schema, codegenOptions{lang: lang, typeName: "Event"})
+		if err != nil {
+			t.Fatalf("%s codegen failed: %v", lang, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(code), want) {
+				t.Errorf("expected %s code to contain %q, got:\n%s", lang, want, code)
+			}
+		}
+	}
+
+	code, err := generateCode(schema, codegenOptions{lang: "python", typeName: "Event", typedDict: true})
+	if err != nil {
+		t.Fatalf("typeddict codegen failed: %v", err)
+	}
+	for _, want := range []string{"class Event(TypedDict):", "    sentAt: datetime", "    tags: NotRequired[list[str]]"} {
+		if !strings.Contains(string(code), want) {
+			t.Errorf("expected typeddict code to contain %q, got:\n%s", want, code)
+		}
+	}
+}
+
+func TestPythonTypedDictImports(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not installed")
+	}
+	schema := inferSchema([]interface{}{
+		map[string]interface{}{"nested obj": map[string]interface{}{"inner key": int64(1)}, "id": int64(1)},
+	})
+	code, err := generateCode(schema, codegenOptions{lang: "python", typeName: "Event", typedDict: true})
+	if err != nil {
+		t.Fatalf("typeddict codegen failed: %v", err)
+	}
+
+	path := filepath.Join(setupTestDir(t), "event.py")
+	writeTestFile(t, path, code)
+	if out, err := exec.Command(python, path).CombinedOutput(); err != nil {
+		t.Fatalf("generated module failed to import: %v\n%s\n%s", err, out, code)
+	}
+}
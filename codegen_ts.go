@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tsGenerator emits TypeScript interfaces matching what msgpack decoders in
+// JavaScript produce: bin as Uint8Array, timestamps as Date and integers
+// beyond int64 as bigint.
+type tsGenerator struct {
+	names typeNamer
+	decls []string
+}
+
+func generateTypeScript(schema *schemaNode, typeName string) ([]byte, error) {
+	g := &tsGenerator{names: typeNamer{}}
+	g.interfaceType(typeName, schema)
+
+	var sb strings.Builder
+	sb.WriteString("// Code generated by mpt codegen; DO NOT EDIT.\n\n")
+	sb.WriteString(strings.Join(g.decls, "\n"))
+	return []byte(sb.String()), nil
+}
+
+func (g *tsGenerator) interfaceType(name string, n *schemaNode) string {
+	name = g.names.unique(name)
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "export interface %s {\n", name)
+	for _, key := range n.fieldNames() {
+		field := n.fields[key]
+		typ := g.tsType(field, name+pascalCase(key, false))
+		if field.nullable() && field.kind() != kindNull {
+			typ += " | null"
+		}
+
+		prop := key
+		if !jsIdentifier.MatchString(key) {
+			prop = (&literalWriter{lang: FormatTypeScript}).quote(key)
+		}
+		if field.seen < n.objects {
+			prop += "?"
+		}
+		fmt.Fprintf(&sb, "  %s: %s;\n", prop, typ)
+	}
+	sb.WriteString("}\n")
+
+	g.decls[index] = sb.String()
+	return name
+}
+
+func (g *tsGenerator) tsType(n *schemaNode, hint string) string {
+	switch n.kind() {
+	case kindBool:
+		return "boolean"
+	case kindInt, kindFloat:
+		return "number"
+	case kindUint:
+		return "bigint"
+	case kindString:
+		return "string"
+	case kindBytes:
+		return "Uint8Array"
+	case kindTime:
+		return "Date"
+	case kindArray:
+		if n.elem == nil || n.elem.seen == n.elem.nulls {
+			return "unknown[]"
+		}
+		elem := g.tsType(n.elem, singular(hint))
+		if n.elem.nullable() {
+			return "(" + elem + " | null)[]"
+		}
+		return elem + "[]"
+	case kindObject:
+		if len(n.fields) == 0 {
+			return "Record<string, unknown>"
+		}
+		return g.interfaceType(hint, n)
+	case kindNull:
+		return "null"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func runCompareSize(args []string) error {
+	opts, err := parseCompareArgs(args)
+	if err != nil {
+		return err
+	}
+
+	results, err := compareSizes(opts)
+	if err != nil {
+		return err
+	}
+	return writeCompareTable(os.Stdout, results, opts.compress)
+}
+
+func parseCompareArgs(args []string) (compareOptions, error) {
+	opts := compareOptions{runs: 5}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.inputs = append(opts.inputs, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			opts.inputs = append(opts.inputs, arg)
+			continue
+		}
+
+		switch arg {
+		case "-h", "--help":
+			return opts, errHelp
+		case "--from", "--compress", "--runs":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires a value: %w", arg, errUsage)
+			}
+			value := args[i+1]
+			i++
+			switch arg {
+			case "--from":
+				format, err := parseFormat(value)
+				if err != nil {
+					return opts, err
+				}
+				opts.from = format
+			case "--compress":
+				for _, name := range strings.Split(value, ",") {
+					if _, ok := compressors[name]; !ok {
+						return opts, fmt.Errorf("unknown compression %q (want gzip, zstd or xz): %w", name, errUsage)
+					}
+					opts.compress = append(opts.compress, name)
+				}
+			default:
+				runs, err := parseWidth(arg, value, 1, 1000)
+				if err != nil {
+					return opts, err
+				}
+				opts.runs = runs
+			}
+		default:
+			return opts, fmt.Errorf("unknown compare-size flag %q: %w", arg, errUsage)
+		}
+	}
+
+	if len(opts.inputs) != 1 {
+		return opts, fmt.Errorf("compare-size expects exactly one input file: %w", errUsage)
+	}
+	return opts, nil
+}
+
+var compressors = map[string]Compression{
+	"gzip": CompressionGzip,
+	"zstd": CompressionZstd,
+	"xz":   CompressionXZ,
+}
+
+// sizeEncoding is one row of the comparison: how to encode the value, and
+// which format decodes the result.
+type sizeEncoding struct {
+	name   string
+	decode Format
+	encode func(interface{}) ([]byte, error)
+	// binary encodings get the raw decoded value; text formats get ext
+	// values in their readable form.
+	binary bool
+}
+
+var sizeEncodings = []sizeEncoding{
+	{"msgpack", FormatMsgpack, msgpack.Marshal, true},
+	{"msgpack compact", FormatMsgpack, encodeCompactMsgpack, true},
+	{"json", FormatJSON, outputStyle{}.encodeJSON, false},
+	{"json compact", FormatJSON, outputStyle{compact: true}.encodeJSON, false},
+	{"yaml", FormatYAML, outputStyle{}.encodeYAML, false},
+	{"plist", FormatPlist, func(v interface{}) ([]byte, error) { return encodePlist(v, FormatPlist) }, false},
+	{"bplist", FormatBinaryPlist, func(v interface{}) ([]byte, error) { return encodePlist(v, FormatBinaryPlist) }, false},
+}
+
+// encodeCompactMsgpack uses the smallest msgpack int and float encodings
+// that hold each value.
+func encodeCompactMsgpack(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	err := enc.Encode(value)
+	return buf.Bytes(), err
+}
+
+type sizeResult struct {
+	name       string
+	size       int
+	compressed map[string]int
+	encode     time.Duration
+	decode     time.Duration
+	err        error
+}
+
+func compareSizes(opts compareOptions) ([]sizeResult, error) {
+	input := opts.inputs[0]
+	fromFormat := opts.from
+	if fromFormat == FormatUnknown {
+		detected, err := detectFormat(input)
+		if err != nil {
+			return nil, err
+		}
+		fromFormat = detected
+	}
+	data, err := options{}.readInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := decodeData(data, fromFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+	// Decode again for the text formats, since unpacking ext values
+	// rewrites the value in place.
+	textValue, err := decodeData(data, fromFormat)
+	if err == nil {
+		textValue, err = extRegistry(nil).unpack(textValue)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+
+	var results []sizeResult
+	for _, e := range sizeEncodings {
+		value := textValue
+		if e.binary {
+			value = decoded
+		}
+		results = append(results, measureEncoding(e, value, opts))
+	}
+	return results, nil
+}
+
+func measureEncoding(e sizeEncoding, value interface{}, opts compareOptions) sizeResult {
+	result := sizeResult{name: e.name, compressed: make(map[string]int)}
+
+	var out []byte
+	start := time.Now()
+	for i := 0; i < opts.runs; i++ {
+		if out, result.err = e.encode(value); result.err != nil {
+			return result
+		}
+	}
+	result.encode = time.Since(start) / time.Duration(opts.runs)
+	result.size = len(out)
+
+	start = time.Now()
+	for i := 0; i < opts.runs; i++ {
+		if _, result.err = decodeData(out, e.decode); result.err != nil {
+			return result
+		}
+	}
+	result.decode = time.Since(start) / time.Duration(opts.runs)
+
+	for _, name := range opts.compress {
+		compressed, err := compressData(out, compressors[name], 0)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.compressed[name] = len(compressed)
+	}
+	return result
+}
+
+func writeCompareTable(w io.Writer, results []sizeResult, compress []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"format", "bytes", "vs json"}
+	header = append(header, compress...)
+	header = append(header, "encode", "decode")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	baseline := 0
+	for _, r := range results {
+		if r.name == "json" && r.err == nil {
+			baseline = r.size
+		}
+	}
+
+	var failed []sizeResult
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		row := []string{r.name, fmt.Sprint(r.size), "-"}
+		if baseline > 0 {
+			row[2] = fmt.Sprintf("%.1f%%", float64(r.size)*100/float64(baseline))
+		}
+		for _, name := range compress {
+			row = append(row, fmt.Sprint(r.compressed[name]))
+		}
+		row = append(row, formatDuration(r.encode), formatDuration(r.decode))
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, r := range failed {
+		fmt.Fprintf(w, "%s: not comparable: %v\n", r.name, r.err)
+	}
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.Round(100 * time.Nanosecond).String()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareSize(t *testing.T) {
+	dir := setupTestDir(t)
+	input := filepath.Join(dir, "data.json")
+	writeTestFile(t, input, []byte(`{"id": 1, "name": "abc", "tags": ["a", "b"], "missing": null}`))
+
+	opts, err := parseCompareArgs([]string{"--compress", "gzip,zstd", "--runs", "1", input})
+	if err != nil {
+		t.Fatalf("parseCompareArgs failed: %v", err)
+	}
+	results, err := compareSizes(opts)
+	if err != nil {
+		t.Fatalf("compareSizes failed: %v", err)
+	}
+
+	sizes := make(map[string]sizeResult)
+	for _, r := range results {
+		sizes[r.name] = r
+	}
+	if sizes["msgpack compact"].size >= sizes["json compact"].size || sizes["json compact"].size >= sizes["json"].size {
+		t.Errorf("unexpected size ordering: %+v", results)
+	}
+	if sizes["json"].compressed["gzip"] == 0 || sizes["json"].compressed["zstd"] == 0 {
+		t.Errorf("missing compressed sizes: %+v", sizes["json"])
+	}
+	if sizes["plist"].err == nil {
+		t.Error("plist should not be able to represent null")
+	}
+
+	var out bytes.Buffer
+	if err := writeCompareTable(&out, results, opts.compress); err != nil {
+		t.Fatalf("writeCompareTable failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "100.0%") || !strings.Contains(out.String(), "plist: not comparable") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+
+	_, err = parseCompareArgs([]string{"--compress", "brotli", input})
+	assertError(t, err, "unknown compression")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func (c Compression) String() string {
+	return string(c)
+}
+
+func parseCompression(s string) (Compression, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return CompressionNone, nil
+	case "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	case "xz":
+		return CompressionXZ, nil
+	default:
+		return CompressionAuto, fmt.Errorf("unknown compression %q (want gzip, zstd, xz or none): %w", s, errUsage)
+	}
+}
+
+// suffix is the extension added to a file compressed with c.
+func (c Compression) suffix() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	case CompressionXZ:
+		return ".xz"
+	default:
+		return ""
+	}
+}
+
+// compressionFromExt reads the compression from the last extension, as in
+// data.msgpack.gz, and returns the path without it.
+func compressionFromExt(path string) (Compression, string) {
+	ext := filepath.Ext(path)
+	switch strings.ToLower(ext) {
+	case ".gz", ".gzip":
+		return CompressionGzip, strings.TrimSuffix(path, ext)
+	case ".zst", ".zstd":
+		return CompressionZstd, strings.TrimSuffix(path, ext)
+	case ".xz":
+		return CompressionXZ, strings.TrimSuffix(path, ext)
+	default:
+		return CompressionNone, path
+	}
+}
+
+func trimCompressionExt(path string) string {
+	_, trimmed := compressionFromExt(path)
+	return trimmed
+}
+
+var compressionMagic = []struct {
+	c     Compression
+	magic []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionXZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+func sniffCompression(data []byte) Compression {
+	for _, m := range compressionMagic {
+		if bytes.HasPrefix(data, m.magic) {
+			return m.c
+		}
+	}
+	return CompressionNone
+}
+
+// readInput reads a file and undoes its compression: the one given with
+// --decompress, or the one its magic bytes show.
+func (o options) readInput(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if data, err = o.decompressInput(data); err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func (o options) decompressInput(data []byte) ([]byte, error) {
+	c := o.decompress
+	if c == CompressionAuto {
+		c = sniffCompression(data)
+	}
+	return decompressData(data, c)
+}
+
+// inputCompressed reports whether readInput would decompress path, for
+// callers that read uncompressed files in place.
+func (o options) inputCompressed(path string) (bool, error) {
+	if o.decompress != CompressionAuto {
+		return o.decompress != CompressionNone, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 6)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return sniffCompression(head[:n]) != CompressionNone, nil
+}
+
+// outputCompression is --compress, or the compression named by the
+// output's extension.
+func (o options) outputCompression(path string) Compression {
+	if o.compress != CompressionAuto {
+		return o.compress
+	}
+	c, _ := compressionFromExt(path)
+	return c
+}
+
+func decompressData(data []byte, c Compression) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	case CompressionZstd:
+		dec, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return dec.DecodeAll(data, nil)
+	case CompressionXZ:
+		xr, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = xr
+	default:
+		return data, nil
+	}
+	return io.ReadAll(r)
+}
+
+// xzDictCaps maps levels 0 to 9 to the dictionary sizes xz(1) uses for
+// them.
+var xzDictCaps = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// compressData compresses data with c at level, where 0 picks the
+// compressor's default.
+func compressData(data []byte, c Compression, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch c {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		} else if level > gzip.BestCompression {
+			return nil, fmt.Errorf("gzip level must be 1 to 9, got %d", level)
+		}
+		w, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		return buf.Bytes(), err
+	case CompressionZstd:
+		encLevel := zstd.SpeedDefault
+		if level > 0 {
+			encLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(encLevel))
+		if err != nil {
+			return nil, err
+		}
+		defer enc.Close()
+		return enc.EncodeAll(data, nil), nil
+	case CompressionXZ:
+		config := xz.WriterConfig{}
+		if level > 0 {
+			if level >= len(xzDictCaps) {
+				return nil, fmt.Errorf("xz level must be 1 to 9, got %d", level)
+			}
+			config.DictCap = xzDictCaps[level]
+		}
+		w, err := config.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		return buf.Bytes(), err
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// extValue is a msgpack ext value kept as raw bytes. Every ext type except
+// the timestamp (-1) decodes to an *extValue, so unknown types survive a
+// msgpack to msgpack conversion unchanged.
+type extValue struct {
+	Type int8
+	Data []byte
+}
+
+var _ msgpack.CustomEncoder = (*extValue)(nil)
+
+func (e *extValue) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeExtHeader(e.Type, len(e.Data)); err != nil {
+		return err
+	}
+	_, err := enc.Writer().Write(e.Data)
+	return err
+}
+
+func init() {
+	for id := math.MinInt8; id <= math.MaxInt8; id++ {
+		if id == -1 {
+			continue
+		}
+		extID := int8(id)
+		msgpack.RegisterExtDecoder(extID, (*extValue)(nil), func(d *msgpack.Decoder, v reflect.Value, extLen int) error {
+			data := make([]byte, extLen)
+			if err := d.ReadFull(data); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(&extValue{Type: extID, Data: data}))
+			return nil
+		})
+	}
+}
+
+// extRegistry describes how ext types are rendered in text formats. It is
+// loaded from a YAML file keyed by ext type:
+//
+//	3: {type: uuid}
+//	5: {type: decimal, scale: 4, name: price}
+//	7: {type: struct, name: geo, fields: [{name: lat, type: float64}, {name: lng, type: float64}]}
+//
+// Values render as single-key objects such as {"$uuid": "..."} and are turned
+// back into ext bytes when writing msgpack. Types without an entry render as
+// {"$ext": {"type": 9, "data": "<base64>"}}.
+type extRegistry map[int8]*extCodec
+
+type extCodec struct {
+	ID     int8
+	Name   string      `yaml:"name"`
+	Type   string      `yaml:"type"`
+	Scale  int         `yaml:"scale"`
+	Size   int         `yaml:"size"`
+	Fields []*extCodec `yaml:"fields"`
+}
+
+func loadExtRegistry(path string) (extRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var raw map[int]*extCodec
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse ext registry %s: %w", path, err)
+	}
+
+	registry := make(extRegistry, len(raw))
+	names := make(map[string]int)
+	for id, codec := range raw {
+		if id < math.MinInt8 || id > math.MaxInt8 || id == -1 {
+			return nil, fmt.Errorf("ext registry %s: invalid ext type %d", path, id)
+		}
+		if codec == nil {
+			return nil, fmt.Errorf("ext registry %s: ext %d has no definition", path, id)
+		}
+		codec.ID = int8(id)
+		if codec.Name == "" {
+			codec.Name = codec.Type
+		}
+		if err := codec.validate(); err != nil {
+			return nil, fmt.Errorf("ext registry %s: ext %d: %w", path, id, err)
+		}
+		if other, ok := names[codec.Name]; ok || codec.Name == "ext" {
+			return nil, fmt.Errorf("ext registry %s: name %q used by ext %d and %d", path, codec.Name, other, id)
+		}
+		names[codec.Name] = id
+		registry[codec.ID] = codec
+	}
+	return registry, nil
+}
+
+func (c *extCodec) validate() error {
+	switch c.Type {
+	case "uuid", "string", "hex", "base64", "msgpack":
+	case "int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64":
+	case "decimal":
+		if c.Scale < 0 {
+			return fmt.Errorf("decimal scale must not be negative")
+		}
+		switch c.Size {
+		case 0:
+			c.Size = 8
+		case 1, 2, 4, 8:
+		default:
+			return fmt.Errorf("decimal size must be 1, 2, 4 or 8 bytes")
+		}
+	case "struct":
+		if len(c.Fields) == 0 {
+			return fmt.Errorf("struct needs fields")
+		}
+		for _, field := range c.Fields {
+			if field.Name == "" {
+				return fmt.Errorf("struct fields need names")
+			}
+			if fixedWidth(field.Type) == 0 {
+				return fmt.Errorf("struct field %q must be a fixed-size number, got %q", field.Name, field.Type)
+			}
+		}
+	case "":
+		return fmt.Errorf("missing type")
+	default:
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+	return nil
+}
+
+func fixedWidth(typ string) int {
+	switch typ {
+	case "int8", "uint8":
+		return 1
+	case "int16", "uint16":
+		return 2
+	case "int32", "uint32", "float32":
+		return 4
+	case "int64", "uint64", "float64":
+		return 8
+	}
+	return 0
+}
+
+// unpack replaces ext values with their readable single-key object form.
+func (r extRegistry) unpack(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case *extValue:
+		codec, ok := r[v.Type]
+		if !ok {
+			return map[string]interface{}{"$ext": map[string]interface{}{
+				"type": int64(v.Type),
+				"data": base64.StdEncoding.EncodeToString(v.Data),
+			}}, nil
+		}
+		decoded, err := codec.decode(v.Data)
+		if err != nil {
+			return nil, fmt.Errorf("ext %d (%s): %w", v.Type, codec.Name, err)
+		}
+		return map[string]interface{}{"$" + codec.Name: decoded}, nil
+	case map[string]interface{}:
+		for key, val := range v {
+			unpacked, err := r.unpack(val)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = unpacked
+		}
+	case []interface{}:
+		for i, val := range v {
+			unpacked, err := r.unpack(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = unpacked
+		}
+	}
+	return value, nil
+}
+
+// pack is the inverse of unpack, turning single-key objects named after a
+// registered ext type, or $ext, into ext values.
+func (r extRegistry) pack(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for key, val := range v {
+				if ext, ok, err := r.packOne(key, val); ok || err != nil {
+					return ext, err
+				}
+			}
+		}
+		for key, val := range v {
+			packed, err := r.pack(val)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = packed
+		}
+	case []interface{}:
+		for i, val := range v {
+			packed, err := r.pack(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = packed
+		}
+	}
+	return value, nil
+}
+
+func (r extRegistry) packOne(key string, value interface{}) (interface{}, bool, error) {
+	if !strings.HasPrefix(key, "$") {
+		return nil, false, nil
+	}
+	name := key[1:]
+
+	if name == "ext" {
+		// Anything but {"type": n, "data": "<base64>"} is left as data.
+		raw, ok := value.(map[string]interface{})
+		if !ok || len(raw) != 2 {
+			return nil, false, nil
+		}
+		id, okID := toInt64(raw["type"])
+		data, okData := raw["data"].(string)
+		if !okID || !okData || id < math.MinInt8 || id > math.MaxInt8 {
+			return nil, false, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, false, nil
+		}
+		return &extValue{Type: int8(id), Data: b}, true, nil
+	}
+
+	for _, codec := range r {
+		if codec.Name != name {
+			continue
+		}
+		data, err := codec.encode(value)
+		if err != nil {
+			return nil, true, fmt.Errorf("ext %d (%s): %w", codec.ID, codec.Name, err)
+		}
+		return &extValue{Type: codec.ID, Data: data}, true, nil
+	}
+	return nil, false, nil
+}
+
+func (c *extCodec) decode(data []byte) (interface{}, error) {
+	switch c.Type {
+	case "uuid":
+		if len(data) != 16 {
+			return nil, fmt.Errorf("uuid needs 16 bytes, got %d", len(data))
+		}
+		h := hex.EncodeToString(data)
+		return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32], nil
+	case "string":
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("invalid utf-8")
+		}
+		return string(data), nil
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	case "msgpack":
+		var value interface{}
+		if err := msgpack.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return normalizeValue(value), nil
+	case "decimal":
+		n, err := readSigned(data)
+		if err != nil {
+			return nil, err
+		}
+		return formatDecimal(n, c.Scale), nil
+	case "struct":
+		out := make(map[string]interface{}, len(c.Fields))
+		offset := 0
+		for _, field := range c.Fields {
+			width := fixedWidth(field.Type)
+			if offset+width > len(data) {
+				return nil, fmt.Errorf("struct needs more than %d bytes", len(data))
+			}
+			out[field.Name] = readFixed(field.Type, data[offset:offset+width])
+			offset += width
+		}
+		if offset != len(data) {
+			return nil, fmt.Errorf("struct uses %d bytes, got %d", offset, len(data))
+		}
+		return out, nil
+	default:
+		if width := fixedWidth(c.Type); width != len(data) {
+			return nil, fmt.Errorf("%s needs %d bytes, got %d", c.Type, width, len(data))
+		}
+		return readFixed(c.Type, data), nil
+	}
+}
+
+func (c *extCodec) encode(value interface{}) ([]byte, error) {
+	switch c.Type {
+	case "uuid":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("uuid must be a string")
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+		if err != nil || len(b) != 16 {
+			return nil, fmt.Errorf("invalid uuid %q", s)
+		}
+		return b, nil
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be a string")
+		}
+		return []byte(s), nil
+	case "hex":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be a hex string")
+		}
+		return hex.DecodeString(s)
+	case "base64":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value must be a base64 string")
+		}
+		return base64.StdEncoding.DecodeString(s)
+	case "msgpack":
+		return msgpack.Marshal(value)
+	case "decimal":
+		n, err := parseDecimal(value, c.Scale)
+		if err != nil {
+			return nil, err
+		}
+		return writeSigned(n, c.Size)
+	case "struct":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("value must be an object")
+		}
+		var out []byte
+		for _, field := range c.Fields {
+			b, err := writeFixed(field.Type, obj[field.Name])
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", field.Name, err)
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	default:
+		return writeFixed(c.Type, value)
+	}
+}
+
+func readFixed(typ string, b []byte) interface{} {
+	switch typ {
+	case "int8":
+		return int8(b[0])
+	case "int16":
+		return int16(binary.BigEndian.Uint16(b))
+	case "int32":
+		return int32(binary.BigEndian.Uint32(b))
+	case "int64":
+		return int64(binary.BigEndian.Uint64(b))
+	case "uint8":
+		return b[0]
+	case "uint16":
+		return binary.BigEndian.Uint16(b)
+	case "uint32":
+		return binary.BigEndian.Uint32(b)
+	case "uint64":
+		return binary.BigEndian.Uint64(b)
+	case "float32":
+		return math.Float32frombits(binary.BigEndian.Uint32(b))
+	default:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+}
+
+func writeFixed(typ string, value interface{}) ([]byte, error) {
+	b := make([]byte, fixedWidth(typ))
+	switch typ {
+	case "float32", "float64":
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a number, got %T", typ, value)
+		}
+		if typ == "float32" {
+			binary.BigEndian.PutUint32(b, math.Float32bits(float32(f)))
+		} else {
+			binary.BigEndian.PutUint64(b, math.Float64bits(f))
+		}
+		return b, nil
+	case "uint8", "uint16", "uint32", "uint64":
+		n, ok := toUint64(value)
+		if !ok || (len(b) < 8 && n >= 1<<(8*len(b))) {
+			return nil, fmt.Errorf("%v does not fit %s", value, typ)
+		}
+		putUint(b, n)
+		return b, nil
+	default:
+		n, ok := toInt64(value)
+		bits := 8 * len(b)
+		if !ok || (bits < 64 && (n < -(1<<(bits-1)) || n >= 1<<(bits-1))) {
+			return nil, fmt.Errorf("%v does not fit %s", value, typ)
+		}
+		putUint(b, uint64(n))
+		return b, nil
+	}
+}
+
+func putUint(b []byte, n uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+}
+
+func readSigned(b []byte) (int64, error) {
+	switch len(b) {
+	case 1, 2, 4, 8:
+	default:
+		return 0, fmt.Errorf("integer needs 1, 2, 4 or 8 bytes, got %d", len(b))
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	shift := 64 - 8*uint(len(b))
+	return int64(n<<shift) >> shift, nil
+}
+
+func writeSigned(n int64, size int) ([]byte, error) {
+	bits := 8 * size
+	if bits < 64 && (n < -(1<<(bits-1)) || n >= 1<<(bits-1)) {
+		return nil, fmt.Errorf("%d does not fit in %d bytes", n, size)
+	}
+	b := make([]byte, size)
+	putUint(b, uint64(n))
+	return b, nil
+}
+
+// formatDecimal renders a fixed-point integer as a decimal string so that no
+// precision is lost to floating point.
+func formatDecimal(n int64, scale int) string {
+	sign := ""
+	u := uint64(n)
+	if n < 0 {
+		sign = "-"
+		u = uint64(-n)
+	}
+	digits := strconv.FormatUint(u, 10)
+	if scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+func parseDecimal(value interface{}, scale int) (int64, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = strings.TrimSpace(v)
+	case float32, float64:
+		f, _ := toFloat64(v)
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	default:
+		n, ok := toInt64(v)
+		if !ok {
+			return 0, fmt.Errorf("decimal needs a string or number, got %T", value)
+		}
+		s = strconv.FormatInt(n, 10)
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > scale {
+		if strings.Trim(frac[scale:], "0") != "" {
+			return 0, fmt.Errorf("%s has more than %d decimal places", s, scale)
+		}
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	return n, nil
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int, int8, int16, int32, int64:
+		return int64Value(v), true
+	case uint, uint8, uint16, uint32, uint64:
+		n := uint64Value(v)
+		return int64(n), n <= math.MaxInt64
+	case float64:
+		return int64(v), v == math.Trunc(v) && math.Abs(v) < 1<<63
+	case float32:
+		return int64(v), float64(v) == math.Trunc(float64(v)) && math.Abs(float64(v)) < 1<<63
+	}
+	return 0, false
+}
+
+func toUint64(value interface{}) (uint64, bool) {
+	switch v := value.(type) {
+	case uint, uint8, uint16, uint32, uint64:
+		return uint64Value(v), true
+	}
+	n, ok := toInt64(value)
+	return uint64(n), ok && n >= 0
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int, int8, int16, int32, int64:
+		return float64(int64Value(v)), true
+	case uint, uint8, uint16, uint32, uint64:
+		return float64(uint64Value(v)), true
+	}
+	return 0, false
+}
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"go/parser"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"gopkg.in/yaml.v3"
 )
 
 func TestYAMLComments(t *testing.T) {
@@ -71,3 +83,397 @@ func TestMsgpackBinaryVsString(t *testing.T) {
 	rtData, _ := readFile(roundtrip)
 	assertJSONEqual(t, testJSON, rtData)
 }
+
+func TestJSONCInput(t *testing.T) {
+	dir := setupTestDir(t)
+
+	jsonc := []byte(`{
+		// service name
+		"name": "svc", /* inline */
+		"ports": [80, 443,],
+	}`)
+
+	input := filepath.Join(dir, "config.jsonc")
+	output := filepath.Join(dir, "config.msgpack")
+	roundtrip := filepath.Join(dir, "roundtrip.json")
+
+	writeTestFile(t, input, jsonc)
+
+	format, err := detectFormat(input)
+	if err != nil || format != FormatJSONC {
+		t.Fatalf("expected jsonc format, got %q (%v)", format, err)
+	}
+
+	testConvertFile(t, input, output, FormatJSONC, FormatMsgpack)
+	testConvertFile(t, output, roundtrip, FormatMsgpack, FormatJSON)
+
+	rtData, _ := readFile(roundtrip)
+	assertJSONEqual(t, []byte(`{"name":"svc","ports":[80,443]}`), rtData)
+
+	_, err = convertData([]byte(`{unquoted: 1}`), FormatJSONC, FormatJSON)
+	assertError(t, err, "decode jsonc")
+}
+
+func TestJSON5Input(t *testing.T) {
+	json5 := []byte(`{
+		unquoted: 'single \'quoted\'',
+		hex: 0xFF,
+		leading: .5,
+		trailing: 2.,
+		positive: +1,
+		multiline: "a\
+b",
+	}`)
+
+	output, err := convertData(json5, FormatJSON5, FormatJSON)
+	if err != nil {
+		t.Fatalf("json5 conversion failed: %v", err)
+	}
+
+	expected := []byte(`{"unquoted":"single 'quoted'","hex":255,"leading":0.5,"trailing":2,"positive":1,"multiline":"ab"}`)
+	assertJSONEqual(t, expected, output)
+}
+
+func TestJSON5MatchesJSON(t *testing.T) {
+	doc := []byte(`{"big": 99999999999999999999999, "huge": 1e400, "max": 9223372036854775807, "dup": 1, "dup": 2}`)
+
+	fromJSON, err := convertData(doc, FormatJSON, FormatJSON)
+	if err != nil {
+		t.Fatalf("json conversion failed: %v", err)
+	}
+	for _, format := range []Format{FormatJSONC, FormatJSON5} {
+		output, err := convertData(doc, format, FormatJSON)
+		if err != nil {
+			t.Fatalf("%s conversion failed: %v", format, err)
+		}
+		assertJSONEqual(t, fromJSON, output)
+	}
+
+	output, err := convertData([]byte(`{big: 0x100000000000000000}`), FormatJSON5, FormatJSON)
+	if err != nil {
+		t.Fatalf("json5 conversion failed: %v", err)
+	}
+	assertJSONEqual(t, []byte(`{"big":295147905179352830000}`), output)
+}
+
+func TestJSONCKeepComments(t *testing.T) {
+	jsonc := []byte(`{
+		// service name
+		"name": "svc", // trailing
+		"enabled": true
+	}`)
+
+	opts := options{keepComments: true}
+	output, err := opts.convertData(jsonc, FormatJSONC, FormatYAML)
+	if err != nil {
+		t.Fatalf("jsonc to yaml failed: %v", err)
+	}
+
+	assertValidYAML(t, output)
+	for _, want := range []string{"# service name\nname: svc", "svc # trailing", "enabled: true"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("expected yaml output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestPlistMsgpackTypes(t *testing.T) {
+	dir := setupTestDir(t)
+
+	xmlPlist := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>name</key>
+	<string>settings</string>
+	<key>blob</key>
+	<data>aGVsbG8=</data>
+	<key>created</key>
+	<date>2024-05-01T12:30:00Z</date>
+</dict>
+</plist>`)
+
+	input := filepath.Join(dir, "settings.plist")
+	output := filepath.Join(dir, "settings.msgpack")
+	binary := filepath.Join(dir, "binary.plist")
+	roundtrip := filepath.Join(dir, "roundtrip.msgpack")
+
+	writeTestFile(t, input, xmlPlist)
+
+	testConvertFile(t, input, output, FormatPlist, FormatMsgpack)
+	testConvertFile(t, output, binary, FormatMsgpack, FormatBinaryPlist)
+	testConvertFile(t, binary, roundtrip, FormatPlist, FormatMsgpack)
+
+	for _, path := range []string{output, roundtrip} {
+		data, _ := readFile(path)
+		var decoded map[string]interface{}
+		if err := msgpack.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("invalid msgpack in %s: %v", path, err)
+		}
+		if blob, ok := decoded["blob"].([]byte); !ok || string(blob) != "hello" {
+			t.Errorf("expected blob to decode as bin, got %#v", decoded["blob"])
+		}
+		created, ok := decoded["created"].(time.Time)
+		if !ok || !created.Equal(time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)) {
+			t.Errorf("expected created to decode as timestamp, got %#v", decoded["created"])
+		}
+	}
+
+	binData, _ := readFile(binary)
+	if !bytes.HasPrefix(binData, []byte("bplist00")) {
+		t.Errorf("expected binary plist header, got %q", binData[:8])
+	}
+
+	_, err := convertData([]byte(`{"missing":null}`), FormatJSON, FormatPlist)
+	assertError(t, err, "cannot represent null")
+}
+
+func TestProtowireSchemaless(t *testing.T) {
+	var nested []byte
+	nested = protowire.AppendTag(nested, 1, protowire.VarintType)
+	nested = protowire.AppendVarint(nested, 7)
+
+	var payload []byte
+	payload = protowire.AppendTag(payload, 1, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, 150)
+	payload = protowire.AppendTag(payload, 2, protowire.BytesType)
+	payload = protowire.AppendString(payload, "hello")
+	payload = protowire.AppendTag(payload, 3, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, nested)
+	payload = protowire.AppendTag(payload, 4, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, []byte{0xff, 0x00})
+
+	// Small messages can be printable: this one encodes as " A".
+	var printable []byte
+	printable = protowire.AppendTag(printable, 4, protowire.VarintType)
+	printable = protowire.AppendVarint(printable, 'A')
+	payload = protowire.AppendTag(payload, 5, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, printable)
+
+	output, err := convertData(payload, FormatProtowire, FormatJSON)
+	if err != nil {
+		t.Fatalf("protowire conversion failed: %v", err)
+	}
+
+	expected := []byte(`[
+		{"field":1,"wire":"varint","value":150},
+		{"field":2,"wire":"bytes","value":"hello"},
+		{"field":3,"wire":"bytes","value":[{"field":1,"wire":"varint","value":7}]},
+		{"field":4,"wire":"bytes","value":"/wA="},
+		{"field":5,"wire":"bytes","value":[{"field":4,"wire":"varint","value":65}]}
+	]`)
+	assertJSONEqual(t, expected, output)
+
+	_, err = convertData([]byte{0x0a, 0x05, 'h'}, FormatProtowire, FormatJSON)
+	assertError(t, err, "decode protowire")
+}
+
+func TestProtowireDescriptor(t *testing.T) {
+	dir := setupTestDir(t)
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("event.proto"),
+		Package: proto.String("feeds"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("id"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("tags"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+			},
+		}},
+	}
+	set, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatalf("failed to marshal descriptor set: %v", err)
+	}
+	descPath := filepath.Join(dir, "event.desc")
+	writeTestFile(t, descPath, set)
+
+	var payload []byte
+	payload = protowire.AppendTag(payload, 1, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, 42)
+	payload = protowire.AppendTag(payload, 2, protowire.BytesType)
+	payload = protowire.AppendString(payload, "a")
+	payload = protowire.AppendTag(payload, 2, protowire.BytesType)
+	payload = protowire.AppendString(payload, "b")
+
+	md, err := loadProtoMessage(descPath, "")
+	if err != nil {
+		t.Fatalf("failed to load descriptor: %v", err)
+	}
+
+	opts := options{protoType: md}
+	output, err := opts.convertData(payload, FormatProtowire, FormatJSON)
+	if err != nil {
+		t.Fatalf("protowire conversion failed: %v", err)
+	}
+	assertJSONEqual(t, []byte(`{"id":42,"tags":["a","b"]}`), output)
+
+	_, err = loadProtoMessage(descPath, "feeds.Missing")
+	assertError(t, err, "find message")
+}
+
+func TestTextEncodings(t *testing.T) {
+	msgpackData, err := convertData([]byte(`{"a":1}`), FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("json to msgpack failed: %v", err)
+	}
+
+	inputs := map[Encoding][]string{
+		EncodingHex:       {"81a16101", "0x81 0xa1 0x61 0x01\n", `\x81\xa1\x61\x01`, "0x81,0xa1,\n0x61,0x01"},
+		EncodingBase64:    {"gaFhAQ==", "gaFhAQ", "gaFh\nAQ=="},
+		EncodingBase64URL: {"gaFhAQ"},
+	}
+	for enc, texts := range inputs {
+		for _, text := range texts {
+			opts := options{inputEnc: enc}
+			output, err := opts.convertData([]byte(text), FormatMsgpack, FormatJSON)
+			if err != nil {
+				t.Errorf("%s input %q failed: %v", enc, text, err)
+				continue
+			}
+			assertJSONEqual(t, []byte(`{"a":1}`), output)
+		}
+	}
+
+	opts := options{outputEnc: EncodingHex}
+	output, err := opts.convertData([]byte(`{"a":1}`), FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("hex output failed: %v", err)
+	}
+	if expected := hex.EncodeToString(msgpackData); string(output) != expected {
+		t.Errorf("expected hex %q, got %q", expected, output)
+	}
+
+	opts = options{inputEnc: EncodingHex}
+	_, err = opts.convertData([]byte("8"), FormatMsgpack, FormatJSON)
+	assertError(t, err, "decode hex")
+
+	_, err = parseArgs([]string{"--input-encoding", "rot13", "file.txt"})
+	assertError(t, err, "unknown encoding")
+}
+
+func TestLiteralOutput(t *testing.T) {
+	value := map[string]interface{}{
+		"id":      int8(7),
+		"name":    "mpt \"tools\"",
+		"ratio":   1.0,
+		"blob":    []byte{0x00, 0xff},
+		"created": time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		"tags":    []interface{}{"a", nil, true},
+		"big":     uint64(1 << 60),
+		"empty":   map[string]interface{}{},
+	}
+	data, err := msgpack.Marshal(value)
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+
+	goOutput, err := convertData(data, FormatMsgpack, FormatGo)
+	if err != nil {
+		t.Fatalf("go literal failed: %v", err)
+	}
+	if _, err := parser.ParseExpr(string(goOutput)); err != nil {
+		t.Errorf("go literal does not parse: %v\n%s", err, goOutput)
+	}
+
+	cases := map[Format][]string{
+		FormatGo:         {`"id": int8(7),`, `"ratio": 1.0,`, `[]byte{0x00, 0xff}`, `time.Date(2024, time.May, 1, 12, 30, 0, 0, time.UTC)`, `"empty": map[string]interface{}{},`, "\t\tnil,"},
+		FormatPython:     {`"id": 7,`, `b"\x00\xff"`, `datetime.datetime(2024, 5, 1, 12, 30, 0, 0, tzinfo=datetime.timezone.utc)`, "None,", "True,", `"name": "mpt \"tools\"",`},
+		FormatTypeScript: {`id: 7,`, `new Uint8Array([0, 255])`, `new Date("2024-05-01T12:30:00.000Z")`, `big: 1152921504606846976n,`, "null,"},
+	}
+	for format, wants := range cases {
+		output, err := convertData(data, FormatMsgpack, format)
+		if err != nil {
+			t.Fatalf("%s literal failed: %v", format, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(output), want) {
+				t.Errorf("expected %s literal to contain %q, got:\n%s", format, want, output)
+			}
+		}
+	}
+
+	_, err = convertData([]byte("nil"), FormatGo, FormatJSON)
+	assertError(t, err, "output-only")
+}
+
+func TestOutputStyle(t *testing.T) {
+	input := []byte(`{"a":"<b>é","list":[1,2,3],"long":[1,2,3,4]}`)
+
+	tests := []struct {
+		name     string
+		style    outputStyle
+		to       Format
+		expected string
+	}{
+		{"default json", outputStyle{}, FormatJSON, "{\n  \"a\": \"\\u003cb\\u003eé\",\n  \"list\": [\n    1,\n    2,\n    3\n  ],\n  \"long\": [\n    1,\n    2,\n    3,\n    4\n  ]\n}"},
+		{"compact ascii", outputStyle{compact: true, asciiOnly: true, noEscapeHTML: true}, FormatJSON, `{"a":"<b>\u00e9","list":[1,2,3],"long":[1,2,3,4]}`},
+		{"tabs", outputStyle{tabs: true}, FormatJSON, "{\n\t\"a\": \"\\u003cb\\u003eé\",\n\t\"list\": [\n\t\t1,\n\t\t2,\n\t\t3\n\t],\n\t\"long\": [\n\t\t1,\n\t\t2,\n\t\t3,\n\t\t4\n\t]\n}"},
+		{"yaml flow and quotes", outputStyle{yamlIndent: 2, yamlFlow: 3, yamlQuote: yaml.DoubleQuotedStyle}, FormatYAML, "a: \"<b>é\"\nlist: [1, 2, 3]\nlong:\n- 1\n- 2\n- 3\n- 4\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := options{style: tt.style}.convertData(input, FormatJSON, tt.to)
+			if err != nil {
+				t.Fatalf("conversion failed: %v", err)
+			}
+			if string(out) != tt.expected {
+				t.Errorf("unexpected output:\n%s\nwant:\n%s", out, tt.expected)
+			}
+		})
+	}
+
+	_, err := parseArgs([]string{"--compact", "--indent", "4", "a.json", "b.json"})
+	assertError(t, err, "cannot be combined")
+	_, err = parseArgs([]string{"--yaml-quote", "fancy", "a.json", "b.yaml"})
+	assertError(t, err, "unknown quoting style")
+}
+
+func TestColorView(t *testing.T) {
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"bin":  []byte{1, 2},
+		"ext":  &extValue{Type: 9, Data: []byte{3}},
+		"name": "a<b",
+		"when": time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+
+	opts := options{color: colorAlways}
+	colored, err := opts.renderColor(data, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("renderColor failed: %v", err)
+	}
+	for _, want := range []string{
+		colorKey + `"bin"` + colorReset,
+		colorBin + `"AQI="` + colorReset,
+		colorExt + `"$ext"` + colorReset,
+		colorTime + `"2024-05-01T12:00:00Z"` + colorReset,
+		colorString + `"a\u003cb"` + colorReset,
+	} {
+		if !strings.Contains(string(colored), want) {
+			t.Errorf("colored output missing %q:\n%s", want, colored)
+		}
+	}
+
+	plain, err := opts.convertData(data, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Fatalf("convertData failed: %v", err)
+	}
+	stripped := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAll(colored, nil)
+	if !bytes.Equal(stripped, plain) {
+		t.Errorf("colored output differs from plain json:\n%s\nwant:\n%s", stripped, plain)
+	}
+
+	if (options{color: colorNever}).useColor() {
+		t.Error("--color=never should disable color")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if (options{}).useColor() {
+		t.Error("NO_COLOR should disable automatic color")
+	}
+}
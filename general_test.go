@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 func TestJSONMsgpackRoundtrip(t *testing.T) {
@@ -248,3 +253,268 @@ func TestBatchYAML(t *testing.T) {
 	assertValidYAML(t, yaml0Data)
 	assertValidYAML(t, yaml1Data)
 }
+
+func TestLayoutRoundtrip(t *testing.T) {
+	dir := setupTestDir(t)
+
+	layoutPath := filepath.Join(dir, "layout.yaml")
+	writeTestFile(t, layoutPath, []byte("$: [id, name, items, active]\n$.items[*]: [sku, qty]\n"))
+
+	l, err := loadLayout(layoutPath)
+	if err != nil {
+		t.Fatalf("loadLayout failed: %v", err)
+	}
+	opts := options{layout: l}
+
+	compact, err := msgpack.Marshal([]interface{}{3, "abc", []interface{}{[]interface{}{"a", 1}, []interface{}{"b", 2}}, true})
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+
+	viewed, err := opts.convertData(compact, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Fatalf("expand failed: %v", err)
+	}
+	expected := []byte(`{"id":3,"name":"abc","items":[{"sku":"a","qty":1},{"sku":"b","qty":2}],"active":true}`)
+	assertJSONEqual(t, expected, viewed)
+
+	packed, err := opts.convertData(viewed, FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+	var roundtrip []interface{}
+	if err := msgpack.Unmarshal(packed, &roundtrip); err != nil {
+		t.Fatalf("compacted output is not an array: %v", err)
+	}
+	if len(roundtrip) != 4 || roundtrip[1] != "abc" {
+		t.Errorf("unexpected compact form: %#v", roundtrip)
+	}
+
+	// Arrays shorter than the layout come back the same length.
+	short, _ := msgpack.Marshal([]interface{}{"id", "x", []interface{}{[]interface{}{"c"}}})
+	viewed, err = opts.convertData(short, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Fatalf("expand short array failed: %v", err)
+	}
+	packed, err = opts.convertData(viewed, FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("compact short array failed: %v", err)
+	}
+	if !bytes.Equal(packed, short) {
+		t.Errorf("short array roundtrip = %x, want %x", packed, short)
+	}
+
+	_, err = opts.convertData([]byte(`{"id":1,"unknown":2}`), FormatJSON, FormatMsgpack)
+	assertError(t, err, "not in the layout")
+
+	tooLong, _ := msgpack.Marshal([]interface{}{1, 2, 3, 4, 5})
+	_, err = opts.convertData(tooLong, FormatMsgpack, FormatJSON)
+	assertError(t, err, "names 4 fields, found 5")
+}
+
+func TestExtRegistryRoundtrip(t *testing.T) {
+	dir := setupTestDir(t)
+
+	registryPath := filepath.Join(dir, "ext.yaml")
+	writeTestFile(t, registryPath, []byte("3: {type: uuid}\n5: {type: decimal, scale: 4, name: price}\n7: {type: struct, name: geo, fields: [{name: lat, type: float64}, {name: lng, type: float64}]}\n"))
+
+	registry, err := loadExtRegistry(registryPath)
+	if err != nil {
+		t.Fatalf("loadExtRegistry failed: %v", err)
+	}
+	opts := options{extTypes: registry}
+
+	price := []byte{0, 0, 0, 0, 0, 0x01, 0xe2, 0x40} // 123456
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"id":    &extValue{Type: 3, Data: []byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}},
+		"price": &extValue{Type: 5, Data: price},
+		"raw":   &extValue{Type: 9, Data: []byte{1, 2}},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+
+	viewed, err := opts.convertData(data, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	expected := []byte(`{"id":{"$uuid":"123e4567-e89b-12d3-a456-426614174000"},"price":{"$price":"12.3456"},"raw":{"$ext":{"type":9,"data":"AQI="}}}`)
+	assertJSONEqual(t, expected, viewed)
+
+	packed, err := opts.convertData(viewed, FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("pack failed: %v", err)
+	}
+	var got, want map[string]interface{}
+	if err := msgpack.Unmarshal(packed, &got); err != nil {
+		t.Fatalf("packed output is not a map: %v", err)
+	}
+	_ = msgpack.Unmarshal(data, &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("roundtrip changed ext values:\n got %#v\nwant %#v", got, want)
+	}
+
+	geo, err := opts.convertData([]byte(`{"$geo":{"lat":52.5,"lng":13.25}}`), FormatJSON, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("pack struct failed: %v", err)
+	}
+	back, err := opts.convertData(geo, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Fatalf("render struct failed: %v", err)
+	}
+	assertJSONEqual(t, []byte(`{"$geo":{"lat":52.5,"lng":13.25}}`), back)
+
+	_, err = opts.convertData([]byte(`{"$price":"1.23456"}`), FormatJSON, FormatMsgpack)
+	assertError(t, err, "more than 4 decimal places")
+
+	hexRegistry := extRegistry{4: {ID: 4, Name: "blob", Type: "hex"}}
+	_, err = options{extTypes: hexRegistry}.convertData([]byte(`{"$blob":12}`), FormatJSON, FormatMsgpack)
+	assertError(t, err, "must be a hex string")
+
+	// Lookalike objects stay data, and nothing is packed without a registry.
+	passThrough := []struct {
+		opts options
+		doc  string
+	}{
+		{opts, `{"a":{"$ext":"note"},"b":{"$ext":{"type":1}},"c":{"$ext":{"type":1,"data":"!"}}}`},
+		{options{}, `{"raw":{"$ext":{"type":9,"data":"AQI="}},"id":{"$uuid":"x"}}`},
+	}
+	for _, tc := range passThrough {
+		packed, err := tc.opts.convertData([]byte(tc.doc), FormatJSON, FormatMsgpack)
+		if err != nil {
+			t.Fatalf("lookalike ext objects should pass through: %v", err)
+		}
+		back, err := options{}.convertData(packed, FormatMsgpack, FormatJSON)
+		if err != nil {
+			t.Fatalf("render failed: %v", err)
+		}
+		assertJSONEqual(t, []byte(tc.doc), back)
+	}
+
+	_, err = options{}.convertData(data, FormatMsgpack, FormatJSON)
+	if err != nil {
+		t.Errorf("unknown ext types should render without a registry: %v", err)
+	}
+}
+
+func TestTreeView(t *testing.T) {
+	items := make([]interface{}, 25)
+	for i := range items {
+		items[i] = map[string]interface{}{"sku": i}
+	}
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"blob":  bytes.Repeat([]byte{0xab}, 40),
+		"empty": []interface{}{},
+		"items": items,
+		"meta":  map[string]interface{}{"a": map[string]interface{}{"b": 1}},
+		"name":  strings.Repeat("x", 70),
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+
+	out, err := options{tree: true, treeDepth: 1, treeExpand: []string{"$.items[22]"}}.renderTree(data, FormatMsgpack)
+	if err != nil {
+		t.Fatalf("renderTree failed: %v", err)
+	}
+	expected := `$: {5 keys}
+  blob: <bin 40 bytes> abababababababababababababababab…
+  empty: []
+  items: [25 items]
+    [0]: {…1 key}
+    [1]: {…1 key}
+    [2]: {…1 key}
+    [3]: {…1 key}
+    [4]: {…1 key}
+    [5]: {…1 key}
+    [6]: {…1 key}
+    [7]: {…1 key}
+    [8]: {…1 key}
+    [9]: {…1 key}
+    [10]: {…1 key}
+    [11]: {…1 key}
+    [12]: {…1 key}
+    [13]: {…1 key}
+    [14]: {…1 key}
+    [15]: {…1 key}
+    [16]: {…1 key}
+    [17]: {…1 key}
+    [18]: {…1 key}
+    [19]: {…1 key}
+    [22]: {1 key}
+      sku: 22
+    … 4 more items not shown
+  meta: {…1 key}
+  name: "` + strings.Repeat("x", 60) + `"… (70 chars)
+`
+	if string(out) != expected {
+		t.Errorf("unexpected tree:\n%s\nwant:\n%s", out, expected)
+	}
+
+	_, err = parseArgs([]string{"--tree", "file.msgpack"})
+	assertError(t, err, "require --view")
+}
+
+func TestCompressedFiles(t *testing.T) {
+	dir := setupTestDir(t)
+	input := filepath.Join(dir, "data.json")
+	want := []byte(`{"name":"mpt","tags":["a","b"]}`)
+	writeTestFile(t, input, want)
+	readJSON := func(path string) []byte {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd, CompressionXZ} {
+		packed := filepath.Join(dir, "data.msgpack"+c.suffix())
+		if err := run([]string{"--compress-level", "9", input, packed}); err != nil {
+			t.Fatalf("%s: write failed: %v", c, err)
+		}
+		raw, err := os.ReadFile(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sniffCompression(raw); got != c {
+			t.Errorf("%s output detected as %s", packed, got)
+		}
+
+		// Read back by extension, then with a misleading name by magic bytes.
+		unpacked := filepath.Join(dir, "roundtrip-"+string(c)+".json")
+		if err := run([]string{packed, unpacked}); err != nil {
+			t.Fatalf("%s: read failed: %v", c, err)
+		}
+		assertJSONEqual(t, want, readJSON(unpacked))
+
+		renamed := filepath.Join(dir, "renamed-"+string(c)+".msgpack")
+		if err := os.Rename(packed, renamed); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := readAndConvert(renamed, FormatMsgpack, FormatJSON)
+		if err != nil {
+			t.Fatalf("%s: sniffing failed: %v", c, err)
+		}
+		if !bytes.Contains(decoded, []byte(`"mpt"`)) {
+			t.Errorf("%s: unexpected output %s", c, decoded)
+		}
+	}
+
+	if err := run([]string{"--to-yaml", "--compress", "gzip", input}); err != nil {
+		t.Fatalf("batch --compress failed: %v", err)
+	}
+	assertFileExists(t, filepath.Join(dir, "data.yaml.gz"))
+	if err := run([]string{"--to-json", filepath.Join(dir, "data.yaml.gz"), "--out-dir", filepath.Join(dir, "out")}); err != nil {
+		t.Fatalf("batch from a compressed input failed: %v", err)
+	}
+	assertJSONEqual(t, want, readJSON(filepath.Join(dir, "out", "data.json")))
+
+	err := run([]string{"--decompress", "gzip", input, filepath.Join(dir, "x.yaml")})
+	assertError(t, err, "decompress")
+	err = run([]string{"--compress", "brotli", input, filepath.Join(dir, "x.yaml")})
+	assertError(t, err, "unknown compression")
+	err = run([]string{"--compress-level", "12", input, filepath.Join(dir, "x.json.gz")})
+	assertError(t, err, "gzip level must be 1 to 9")
+}
@@ -3,8 +3,17 @@ module github.com/donuts-are-good/mpt
 go 1.25.3
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.17
 	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/term v0.36.0
+	google.golang.org/protobuf v1.36.9
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
+	howett.net/plist v1.0.1
 )
 
-require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/sys v0.37.0 // indirect
+)
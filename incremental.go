@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const upToDate = "up to date"
+
+// incremental reports whether outputs are treated as build products that
+// --newer or --manifest may replace when they are stale.
+func (o options) incremental() bool {
+	return o.newer || o.manifestFile != ""
+}
+
+// skipNewer marks jobs whose output was modified after their input, the
+// way make decides a target is current.
+func skipNewer(jobs []batchJob) {
+	for i := range jobs {
+		job := &jobs[i]
+		if job.err != nil || job.skip != "" {
+			continue
+		}
+		in, err := os.Stat(job.input)
+		if err != nil {
+			continue
+		}
+		out, err := os.Stat(job.output)
+		if err == nil && !out.ModTime().Before(in.ModTime()) {
+			job.skip = upToDate
+		}
+	}
+}
+
+// manifest records the content hash of every converted input, so a later
+// run only converts inputs whose contents changed. Paths are relative to
+// the manifest file, which keeps it valid when the tree moves. Each entry
+// also records a digest of the options that shape the output, so changing
+// them converts everything again.
+type manifest struct {
+	path    string
+	dir     string
+	options string
+	Version int                      `json:"version"`
+	Files   map[string]manifestEntry `json:"files"`
+	hashes  []string
+}
+
+type manifestEntry struct {
+	SHA256  string `json:"sha256"`
+	Output  string `json:"output"`
+	Options string `json:"options"`
+}
+
+// outputDigest hashes the options that change what a conversion writes,
+// including the contents of the layout, ext type and descriptor files.
+func (o options) outputDigest() (string, error) {
+	h := sha256.New()
+	from := FormatUnknown
+	if o.hasFrom {
+		from = o.from
+	}
+	fmt.Fprintf(h, "to=%s from=%s comments=%t style=%+v\n", o.batchTarget, from, o.keepComments, o.style)
+	fmt.Fprintf(h, "input=%s output=%s decompress=%s compress=%s level=%d\n", o.inputEnc, o.outputEnc, o.decompress, o.compress, o.level)
+	fmt.Fprintf(h, "proto-message=%s\n", o.protoName)
+	for _, file := range []string{o.layoutFile, o.extFile, o.protoFile} {
+		if file == "" {
+			fmt.Fprintln(h, "-")
+			continue
+		}
+		hash, err := hashFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(h, hash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{path: path, dir: filepath.Dir(absPath(path)), Version: 1, Files: make(map[string]manifestEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", path, err)
+	}
+	if m.Version != 1 {
+		return nil, fmt.Errorf("manifest %s: unsupported version %d", path, m.Version)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]manifestEntry)
+	}
+	return m, nil
+}
+
+func (m *manifest) key(path string) string {
+	if rel, err := filepath.Rel(m.dir, absPath(path)); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(absPath(path))
+}
+
+// skipUnchanged hashes every input and marks jobs whose input hash, output
+// path and options match the manifest, as long as the output still exists.
+func (m *manifest) skipUnchanged(jobs []batchJob) {
+	m.hashes = make([]string, len(jobs))
+	for i := range jobs {
+		job := &jobs[i]
+		if job.err != nil || job.skip != "" {
+			continue
+		}
+		hash, err := hashFile(job.input)
+		if err != nil {
+			// Left for the conversion to report.
+			continue
+		}
+		m.hashes[i] = hash
+		entry, ok := m.Files[m.key(job.input)]
+		if ok && entry.SHA256 == hash && entry.Output == m.key(job.output) && entry.Options == m.options && fileExists(job.output) {
+			job.skip = upToDate
+		}
+	}
+}
+
+// update records converted jobs and forgets failed ones, so they are
+// retried on the next run.
+func (m *manifest) update(jobs []batchJob, errs []error) {
+	for i, job := range jobs {
+		key := m.key(job.input)
+		switch {
+		case job.skip != "":
+		case errs[i] == nil && m.hashes[i] != "":
+			m.Files[key] = manifestEntry{SHA256: m.hashes[i], Output: m.key(job.output), Options: m.options}
+		default:
+			delete(m.Files, key)
+		}
+	}
+}
+
+func (m *manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.path, appendNewline(data), false); err != nil {
+		return fmt.Errorf("write manifest %s: %w", m.path, err)
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
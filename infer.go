@@ -0,0 +1,267 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type schemaKind int
+
+const (
+	kindNull schemaKind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindString
+	kindBytes
+	kindTime
+	kindArray
+	kindObject
+	kindAny
+)
+
+// schemaNode accumulates what has been observed at one position across all
+// sample documents. Code generators resolve it to a concrete type per
+// language.
+type schemaNode struct {
+	seen     int
+	nulls    int
+	objects  int
+	bools    bool
+	ints     bool
+	negative bool
+	large    bool
+	floats   bool
+	strings  bool
+	bytes    bool
+	times    bool
+	arrays   bool
+	elem     *schemaNode
+	fields   map[string]*schemaNode
+}
+
+func inferSchema(samples []interface{}) *schemaNode {
+	root := &schemaNode{}
+	for _, sample := range samples {
+		root.observe(sample)
+	}
+	return root
+}
+
+func (n *schemaNode) observe(value interface{}) {
+	n.seen++
+	switch v := value.(type) {
+	case nil:
+		n.nulls++
+	case bool:
+		n.bools = true
+	case int, int8, int16, int32, int64:
+		n.ints = true
+		if int64Value(v) < 0 {
+			n.negative = true
+		}
+	case uint, uint8, uint16, uint32, uint64:
+		n.ints = true
+		if uint64Value(v) > math.MaxInt64 {
+			n.large = true
+		}
+	case float32, float64:
+		n.floats = true
+	case string:
+		n.strings = true
+	case []byte:
+		n.bytes = true
+	case time.Time:
+		n.times = true
+	case []interface{}:
+		n.arrays = true
+		if n.elem == nil {
+			n.elem = &schemaNode{}
+		}
+		for _, item := range v {
+			n.elem.observe(item)
+		}
+	case map[string]interface{}:
+		n.objects++
+		if n.fields == nil {
+			n.fields = make(map[string]*schemaNode)
+		}
+		for key, val := range v {
+			field, ok := n.fields[key]
+			if !ok {
+				field = &schemaNode{}
+				n.fields[key] = field
+			}
+			field.observe(val)
+		}
+	}
+}
+
+// kind resolves the observed values to a single type. Integers widen to
+// floats, integers beyond int64 become unsigned unless negatives were also
+// seen, and any other mix of kinds is reported as kindAny.
+func (n *schemaNode) kind() schemaKind {
+	var kinds []schemaKind
+	if n.bools {
+		kinds = append(kinds, kindBool)
+	}
+	switch {
+	case n.floats:
+		kinds = append(kinds, kindFloat)
+	case n.ints && n.large && n.negative:
+		return kindAny
+	case n.ints && n.large:
+		kinds = append(kinds, kindUint)
+	case n.ints:
+		kinds = append(kinds, kindInt)
+	}
+	if n.strings {
+		kinds = append(kinds, kindString)
+	}
+	if n.bytes {
+		kinds = append(kinds, kindBytes)
+	}
+	if n.times {
+		kinds = append(kinds, kindTime)
+	}
+	if n.arrays {
+		kinds = append(kinds, kindArray)
+	}
+	if n.objects > 0 {
+		kinds = append(kinds, kindObject)
+	}
+
+	switch len(kinds) {
+	case 0:
+		return kindNull
+	case 1:
+		return kinds[0]
+	default:
+		return kindAny
+	}
+}
+
+// nullable reports whether the position was ever null.
+func (n *schemaNode) nullable() bool {
+	return n.nulls > 0
+}
+
+// optional reports whether a field of parent is missing from some objects
+// or sometimes null.
+func (n *schemaNode) optional(parent *schemaNode) bool {
+	return n.seen < parent.objects || n.nullable()
+}
+
+func (n *schemaNode) fieldNames() []string {
+	names := make([]string, 0, len(n.fields))
+	for name := range n.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commonInitialisms are kept upper case in generated identifiers, following
+// the Go convention.
+var commonInitialisms = map[string]bool{
+	"API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true,
+	"GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true,
+	"JSON": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true,
+	"UID": true, "URI": true, "URL": true, "UTF8": true, "UUID": true, "XML": true,
+}
+
+// splitWords breaks a key such as "userId", "user_id" or "user-id" into its
+// words.
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	runes := []rune(s)
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && len(current) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
+
+// pascalCase turns a key into an exported identifier, prefixing keys that
+// would otherwise start with a digit or be empty.
+func pascalCase(s string, initialisms bool) string {
+	var sb strings.Builder
+	for _, word := range splitWords(s) {
+		upper := strings.ToUpper(word)
+		if initialisms && commonInitialisms[upper] {
+			sb.WriteString(upper)
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	name := sb.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "Field" + name
+	}
+	return name
+}
+
+// snakeCase turns a key into a lower_snake_case identifier.
+func snakeCase(s string) string {
+	words := splitWords(s)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	name := strings.Join(words, "_")
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "field_" + name
+	}
+	return name
+}
+
+// singular derives an element type name from a plural field name.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 4:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s") && len(name) > 3:
+		return strings.TrimSuffix(name, "s")
+	default:
+		return name + "Item"
+	}
+}
+
+// typeNamer hands out unique type names across a generated file.
+type typeNamer map[string]bool
+
+func (t typeNamer) unique(name string) string {
+	candidate := name
+	for i := 2; t[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	t[candidate] = true
+	return candidate
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// json5Parser reads JSONC and JSON5 documents into a yaml.Node tree so that
+// comments can be carried over when the output is YAML. JSONC only permits
+// comments and trailing commas; JSON5 additionally allows unquoted keys,
+// single-quoted strings, hex numbers, Infinity/NaN and the other ES5 literals.
+type json5Parser struct {
+	data     []byte
+	pos      int
+	line     int
+	json5    bool
+	comments []string
+}
+
+func parseJSON5Node(data []byte, format Format) (*yaml.Node, error) {
+	p := &json5Parser{data: data, line: 1, json5: format == FormatJSON5}
+	if len(p.data) >= 3 && string(p.data[:3]) == "\xef\xbb\xbf" {
+		p.pos = 3
+	}
+
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	head := p.takeComments()
+
+	node, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	node.HeadComment = joinComments(head, node.HeadComment)
+	if comment, _ := p.trailing(); comment != "" {
+		node.LineComment = comment
+	}
+
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.data) {
+		return nil, p.errorf("unexpected %q after top-level value", p.peekRune())
+	}
+	node.FootComment = joinComments(node.FootComment, p.takeComments())
+	return node, nil
+}
+
+func decodeJSON5(data []byte, format Format) (interface{}, error) {
+	node, err := parseJSON5Node(data, format)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (p *json5Parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *json5Parser) peekRune() rune {
+	r, _ := utf8.DecodeRune(p.data[p.pos:])
+	return r
+}
+
+func (p *json5Parser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.data); i++ {
+		if p.data[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+}
+
+func (p *json5Parser) takeComments() string {
+	comments := strings.Join(p.comments, "\n")
+	p.comments = nil
+	return comments
+}
+
+// skip consumes whitespace and comments, queueing comments so they can be
+// attached to the next node as head comments.
+func (p *json5Parser) skip() error {
+	for p.pos < len(p.data) {
+		r, size := utf8.DecodeRune(p.data[p.pos:])
+		switch {
+		case isJSON5Space(r, p.json5):
+			p.advance(size)
+		case r == '/':
+			comment, err := p.readComment()
+			if err != nil {
+				return err
+			}
+			p.comments = append(p.comments, comment)
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// trailing consumes an optional comma after a value together with a comment
+// on the same line, so that the comment can be attached to that value.
+func (p *json5Parser) trailing() (comment string, comma bool) {
+	pos := p.skipInline(p.pos)
+	if pos < len(p.data) && p.data[pos] == ',' {
+		comma = true
+		pos = p.skipInline(pos + 1)
+	}
+	if p.sameLineComment(pos) {
+		p.pos = pos
+		if c, err := p.readComment(); err == nil {
+			return c, comma
+		}
+	}
+	if comma {
+		p.pos = pos
+	}
+	return "", comma
+}
+
+func (p *json5Parser) skipInline(pos int) int {
+	for pos < len(p.data) && (p.data[pos] == ' ' || p.data[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+func (p *json5Parser) sameLineComment(pos int) bool {
+	if pos+1 >= len(p.data) || p.data[pos] != '/' {
+		return false
+	}
+	switch p.data[pos+1] {
+	case '/':
+		return true
+	case '*':
+		end := strings.Index(string(p.data[pos+2:]), "*/")
+		return end >= 0 && !strings.ContainsRune(string(p.data[pos+2:pos+2+end]), '\n')
+	}
+	return false
+}
+
+func (p *json5Parser) readComment() (string, error) {
+	if p.pos+1 >= len(p.data) {
+		return "", p.errorf("unexpected '/'")
+	}
+	switch p.data[p.pos+1] {
+	case '/':
+		end := p.pos + 2
+		for end < len(p.data) && p.data[end] != '\n' && p.data[end] != '\r' {
+			end++
+		}
+		text := strings.TrimSpace(string(p.data[p.pos+2 : end]))
+		p.pos = end
+		return "# " + text, nil
+	case '*':
+		end := strings.Index(string(p.data[p.pos+2:]), "*/")
+		if end < 0 {
+			return "", p.errorf("unterminated block comment")
+		}
+		body := string(p.data[p.pos+2 : p.pos+2+end])
+		p.advance(end + 4)
+		var lines []string
+		for _, l := range strings.Split(body, "\n") {
+			l = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l), "*"))
+			if l != "" || len(lines) > 0 {
+				lines = append(lines, "# "+l)
+			}
+		}
+		for len(lines) > 0 && lines[len(lines)-1] == "# " {
+			lines = lines[:len(lines)-1]
+		}
+		for i := range lines {
+			lines[i] = strings.TrimRight(lines[i], " ")
+		}
+		return strings.Join(lines, "\n"), nil
+	default:
+		return "", p.errorf("unexpected '/'")
+	}
+}
+
+func (p *json5Parser) parseValue() (*yaml.Node, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || (c == '\'' && p.json5):
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}, nil
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	default:
+		word := p.readIdentifier()
+		switch word {
+		case "true", "false":
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: word}, nil
+		case "null":
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+		case "Infinity", "NaN":
+			if p.json5 {
+				return floatNode(word), nil
+			}
+		}
+		if word == "" {
+			return nil, p.errorf("unexpected %q", p.peekRune())
+		}
+		return nil, p.errorf("unexpected literal %q", word)
+	}
+}
+
+func (p *json5Parser) parseObject() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	index := make(map[string]int)
+	p.advance(1)
+
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated object")
+		}
+		if p.data[p.pos] == '}' {
+			p.advance(1)
+			p.attachFoot(node)
+			return node, nil
+		}
+
+		head := p.takeComments()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, HeadComment: head}
+
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after object key %q", key)
+		}
+		p.advance(1)
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		keyNode.HeadComment = joinComments(keyNode.HeadComment, p.takeComments())
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		comment, comma := p.trailing()
+		if value.Kind == yaml.ScalarNode {
+			value.LineComment = comment
+		} else {
+			keyNode.LineComment = comment
+		}
+		// A repeated key keeps its first position and takes the last
+		// value, as JSON.parse does.
+		if i, ok := index[key]; ok {
+			node.Content[i], node.Content[i+1] = keyNode, value
+		} else {
+			index[key] = len(node.Content)
+			node.Content = append(node.Content, keyNode, value)
+		}
+		if comma {
+			continue
+		}
+
+		done, err := p.separator('}')
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			p.attachFoot(node)
+			return node, nil
+		}
+	}
+}
+
+func (p *json5Parser) parseArray() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	p.advance(1)
+
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.advance(1)
+			p.attachFoot(node)
+			return node, nil
+		}
+
+		head := p.takeComments()
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		value.HeadComment = joinComments(head, value.HeadComment)
+		comment, comma := p.trailing()
+		value.LineComment = comment
+		node.Content = append(node.Content, value)
+		if comma {
+			continue
+		}
+
+		done, err := p.separator(']')
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			p.attachFoot(node)
+			return node, nil
+		}
+	}
+}
+
+// separator consumes the comma between members, reporting whether the
+// closing delimiter was reached instead. A trailing comma is accepted.
+func (p *json5Parser) separator(closing byte) (bool, error) {
+	if err := p.skip(); err != nil {
+		return false, err
+	}
+	if p.pos >= len(p.data) {
+		return false, p.errorf("expected ',' or %q", closing)
+	}
+	switch p.data[p.pos] {
+	case ',':
+		p.advance(1)
+		return false, nil
+	case closing:
+		p.advance(1)
+		return true, nil
+	default:
+		return false, p.errorf("expected ',' or %q, found %q", closing, p.peekRune())
+	}
+}
+
+// attachFoot hangs comments that precede a closing delimiter below the last
+// member of the container.
+func (p *json5Parser) attachFoot(node *yaml.Node) {
+	comments := p.takeComments()
+	if comments == "" {
+		return
+	}
+	if len(node.Content) == 0 {
+		node.FootComment = joinComments(node.FootComment, comments)
+		return
+	}
+	last := node.Content[len(node.Content)-1]
+	if node.Kind == yaml.MappingNode {
+		last = node.Content[len(node.Content)-2]
+	}
+	last.FootComment = joinComments(last.FootComment, comments)
+}
+
+func (p *json5Parser) parseKey() (string, error) {
+	c := p.data[p.pos]
+	if c == '"' || (c == '\'' && p.json5) {
+		return p.parseString()
+	}
+	if !p.json5 {
+		return "", p.errorf("expected string object key, found %q", p.peekRune())
+	}
+	key := p.readIdentifier()
+	if key == "" {
+		return "", p.errorf("invalid object key starting with %q", p.peekRune())
+	}
+	return key, nil
+}
+
+func (p *json5Parser) readIdentifier() string {
+	var sb strings.Builder
+	for p.pos < len(p.data) {
+		r, size := utf8.DecodeRune(p.data[p.pos:])
+		if r == '\\' && p.json5 && p.pos+1 < len(p.data) && p.data[p.pos+1] == 'u' {
+			if p.pos+6 > len(p.data) {
+				break
+			}
+			n, err := strconv.ParseUint(string(p.data[p.pos+2:p.pos+6]), 16, 32)
+			if err != nil {
+				break
+			}
+			sb.WriteRune(rune(n))
+			p.advance(6)
+			continue
+		}
+		if r == '$' || r == '_' || unicode.IsLetter(r) || (sb.Len() > 0 && (unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || unicode.Is(unicode.Pc, r) || r == '\u200c' || r == '\u200d')) {
+			sb.WriteRune(r)
+			p.advance(size)
+			continue
+		}
+		break
+	}
+	return sb.String()
+}
+
+func (p *json5Parser) parseString() (string, error) {
+	quote := p.data[p.pos]
+	p.advance(1)
+
+	var sb strings.Builder
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.errorf("unterminated string")
+		}
+		r, size := utf8.DecodeRune(p.data[p.pos:])
+		switch {
+		case r == rune(quote):
+			p.advance(1)
+			return sb.String(), nil
+		case r == '\n' || r == '\r':
+			return "", p.errorf("unescaped line break in string")
+		case r < 0x20 && !p.json5:
+			return "", p.errorf("invalid control character in string")
+		case r == '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteRune(r)
+			p.advance(size)
+		}
+	}
+}
+
+func (p *json5Parser) parseEscape(sb *strings.Builder) error {
+	if p.pos+1 >= len(p.data) {
+		return p.errorf("unterminated string")
+	}
+	c := p.data[p.pos+1]
+	simple := map[byte]string{'"': "\"", '\\': "\\", '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+	if s, ok := simple[c]; ok {
+		sb.WriteString(s)
+		p.advance(2)
+		return nil
+	}
+	if c == 'u' {
+		r, err := p.readUnicodeEscape(p.pos)
+		if err != nil {
+			return err
+		}
+		p.advance(6)
+		if utf16IsHighSurrogate(r) && p.pos+1 < len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+			if low, err := p.readUnicodeEscape(p.pos); err == nil && low >= 0xdc00 && low <= 0xdfff {
+				r = (r-0xd800)<<10 + (low - 0xdc00) + 0x10000
+				p.advance(6)
+			}
+		}
+		sb.WriteRune(r)
+		return nil
+	}
+	if !p.json5 {
+		return p.errorf("invalid escape sequence \\%c", c)
+	}
+
+	switch c {
+	case '\'':
+		sb.WriteByte('\'')
+	case 'v':
+		sb.WriteByte('\v')
+	case '0':
+		if p.pos+2 < len(p.data) && p.data[p.pos+2] >= '0' && p.data[p.pos+2] <= '9' {
+			return p.errorf("octal escape sequences are not allowed")
+		}
+		sb.WriteByte(0)
+	case 'x':
+		if p.pos+4 > len(p.data) {
+			return p.errorf("invalid \\x escape")
+		}
+		n, err := strconv.ParseUint(string(p.data[p.pos+2:p.pos+4]), 16, 8)
+		if err != nil {
+			return p.errorf("invalid \\x escape")
+		}
+		sb.WriteRune(rune(n))
+		p.advance(4)
+		return nil
+	case '\n':
+		// Line continuation.
+	case '\r':
+		if p.pos+2 < len(p.data) && p.data[p.pos+2] == '\n' {
+			p.advance(1)
+		}
+	default:
+		if c >= '1' && c <= '9' {
+			return p.errorf("invalid escape sequence \\%c", c)
+		}
+		r, size := utf8.DecodeRune(p.data[p.pos+1:])
+		if r == '\u2028' || r == '\u2029' {
+			p.advance(1 + size)
+			return nil
+		}
+		sb.WriteRune(r)
+		p.advance(1 + size)
+		return nil
+	}
+	p.advance(2)
+	return nil
+}
+
+func (p *json5Parser) readUnicodeEscape(pos int) (rune, error) {
+	if pos+6 > len(p.data) {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	n, err := strconv.ParseUint(string(p.data[pos+2:pos+6]), 16, 32)
+	if err != nil {
+		return 0, p.errorf("invalid \\u escape")
+	}
+	return rune(n), nil
+}
+
+func utf16IsHighSurrogate(r rune) bool {
+	return r >= 0xd800 && r <= 0xdbff
+}
+
+func (p *json5Parser) parseNumber() (*yaml.Node, error) {
+	start := p.pos
+	end := p.pos
+	for end < len(p.data) {
+		c := p.data[end]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '.' || c == '+' || c == '-' {
+			if (c == '+' || c == '-') && end > start && p.data[end-1] != 'e' && p.data[end-1] != 'E' {
+				break
+			}
+			end++
+			continue
+		}
+		break
+	}
+	literal := string(p.data[start:end])
+	p.advance(end - start)
+
+	node, ok := numberNode(literal, p.json5)
+	if !ok {
+		return nil, p.errorf("invalid number %q", literal)
+	}
+	return node, nil
+}
+
+// numberNode converts a JSON or JSON5 numeric literal into a YAML scalar
+// with a canonical decimal representation.
+func numberNode(literal string, json5 bool) (*yaml.Node, bool) {
+	sign := ""
+	body := literal
+	if strings.HasPrefix(body, "-") || strings.HasPrefix(body, "+") {
+		if body[0] == '+' && !json5 {
+			return nil, false
+		}
+		if body[0] == '-' {
+			sign = "-"
+		}
+		body = body[1:]
+	}
+
+	if json5 {
+		switch body {
+		case "Infinity":
+			return floatNode(sign + "Infinity"), true
+		case "NaN":
+			return floatNode("NaN"), true
+		}
+		if strings.HasPrefix(body, "0x") || strings.HasPrefix(body, "0X") {
+			n, ok := new(big.Int).SetString(body[2:], 16)
+			if !ok {
+				return nil, false
+			}
+			if sign == "-" {
+				n.Neg(n)
+			}
+			if !n.IsInt64() {
+				f, _ := new(big.Float).SetInt(n).Float64()
+				return floatValueNode(f, literal), true
+			}
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: n.String()}, true
+		}
+	}
+
+	if body == "" || strings.ContainsAny(body, "xXabcdfABCDF") || strings.Count(strings.ToLower(body), "e") > 1 {
+		return nil, false
+	}
+	if !json5 && (strings.HasPrefix(body, ".") || strings.HasSuffix(body, ".") || strings.Contains(body, ".e") || strings.Contains(body, ".E")) {
+		return nil, false
+	}
+	if len(body) > 1 && body[0] == '0' && body[1] >= '0' && body[1] <= '9' {
+		return nil, false
+	}
+
+	if !strings.ContainsAny(body, ".eE") {
+		n, ok := new(big.Int).SetString(sign+body, 10)
+		if !ok {
+			return nil, false
+		}
+		if n.IsInt64() {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: sign + body}, true
+		}
+	}
+
+	f, err := strconv.ParseFloat(sign+body, 64)
+	if err != nil && !isRangeError(err) {
+		return nil, false
+	}
+	return floatValueNode(f, literal), true
+}
+
+// floatValueNode falls back the way JSON numbers do in normalizeValue:
+// integers past int64 become floats, and floats past float64 keep their
+// literal as a string rather than turning into Infinity.
+func floatValueNode(f float64, literal string) *yaml.Node {
+	if math.IsInf(f, 0) {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: literal}
+	}
+	value := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(value, ".eIN") {
+		value += ".0"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value}
+}
+
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+func floatNode(word string) *yaml.Node {
+	value := ".nan"
+	switch word {
+	case "Infinity":
+		value = ".inf"
+	case "-Infinity":
+		value = "-.inf"
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: value}
+}
+
+func isJSON5Space(r rune, json5 bool) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r':
+		return true
+	case '\v', '\f', '\u00a0', '\u2028', '\u2029', '\ufeff':
+		return json5
+	}
+	return json5 && unicode.Is(unicode.Zs, r)
+}
+
+func joinComments(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "\n" + b
+	}
+}
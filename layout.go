@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// layout names the elements of structs that were encoded as positional
+// msgpack arrays (`msgpack:",as_array"`). A layout file maps paths to field
+// names, for example:
+//
+//	$: [id, name, items]
+//	$.items[*]: [sku, qty, price]
+//
+// Paths refer to the named form, so nested entries use the field names given
+// by their parent.
+type layout []layoutEntry
+
+type layoutEntry struct {
+	path   []pathSegment
+	fields []string
+}
+
+func loadLayout(path string) (layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var raw map[string][]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse layout %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var l layout
+	for _, key := range keys {
+		segments, err := parsePath(key)
+		if err != nil {
+			return nil, fmt.Errorf("layout %s: %w", path, err)
+		}
+		seen := make(map[string]bool)
+		for _, field := range raw[key] {
+			if seen[field] {
+				return nil, fmt.Errorf("layout %s: duplicate field %q at %s", path, field, key)
+			}
+			seen[field] = true
+		}
+		l = append(l, layoutEntry{path: segments, fields: raw[key]})
+	}
+
+	// Exact paths take precedence over wildcard paths they overlap with.
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].wildcards() < l[j].wildcards()
+	})
+	return l, nil
+}
+
+func (e layoutEntry) wildcards() int {
+	n := 0
+	for _, seg := range e.path {
+		if seg.wildcard {
+			n++
+		}
+	}
+	return n
+}
+
+func (l layout) fieldsAt(path []pathSegment) []string {
+	for _, entry := range l {
+		if matchPath(entry.path, path) {
+			return entry.fields
+		}
+	}
+	return nil
+}
+
+// expand turns positional arrays at layout paths into objects.
+func (l layout) expand(value interface{}) (interface{}, error) {
+	return l.expandAt(value, nil)
+}
+
+func (l layout) expandAt(value interface{}, path []pathSegment) (interface{}, error) {
+	if fields := l.fieldsAt(path); fields != nil && value != nil {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("layout expects an array at %s, found %T", formatPath(path), value)
+		}
+		if len(items) > len(fields) {
+			return nil, fmt.Errorf("layout for %s names %d fields, found %d elements", formatPath(path), len(fields), len(items))
+		}
+		obj := make(map[string]interface{}, len(items))
+		for i, item := range items {
+			obj[fields[i]] = item
+		}
+		value = obj
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			expanded, err := l.expandAt(val, appendPath(path, keySegment(key)))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, val := range v {
+			expanded, err := l.expandAt(val, appendPath(path, indexSegment(i)))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// compact turns objects at layout paths back into positional arrays, the
+// inverse of expand.
+func (l layout) compact(value interface{}) (interface{}, error) {
+	return l.compactAt(value, nil)
+}
+
+func (l layout) compactAt(value interface{}, path []pathSegment) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			compacted, err := l.compactAt(val, appendPath(path, keySegment(key)))
+			if err != nil {
+				return nil, err
+			}
+			v[key] = compacted
+		}
+	case []interface{}:
+		for i, val := range v {
+			compacted, err := l.compactAt(val, appendPath(path, indexSegment(i)))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = compacted
+		}
+	}
+
+	fields := l.fieldsAt(path)
+	if fields == nil || value == nil {
+		return value, nil
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("layout expects an object at %s, found %T", formatPath(path), value)
+	}
+
+	known := make(map[string]bool, len(fields))
+	items := make([]interface{}, len(fields))
+	for i, field := range fields {
+		known[field] = true
+		items[i] = obj[field]
+	}
+	for key := range obj {
+		if !known[key] {
+			return nil, fmt.Errorf("field %q at %s is not in the layout", key, formatPath(path))
+		}
+	}
+	// expand accepts arrays shorter than the layout, so trailing fields that
+	// are absent are dropped rather than written as nil.
+	n := len(items)
+	for n > 0 {
+		if _, ok := obj[fields[n-1]]; ok {
+			break
+		}
+		n--
+	}
+	return items[:n], nil
+}
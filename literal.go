@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// literalWriter renders a decoded value as source code for Go, Python or
+// TypeScript so that fixtures can be pasted straight into tests. Integer
+// widths, binary data and timestamps keep their msgpack types where the
+// target language can express them.
+type literalWriter struct {
+	buf    bytes.Buffer
+	lang   Format
+	indent string
+}
+
+var jsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func encodeLiteral(value interface{}, format Format) ([]byte, error) {
+	w := &literalWriter{lang: format}
+	switch format {
+	case FormatGo:
+		w.indent = "\t"
+	case FormatPython:
+		w.indent = "    "
+	default:
+		w.indent = "  "
+	}
+	if err := w.write(value, 0); err != nil {
+		return nil, err
+	}
+	return w.buf.Bytes(), nil
+}
+
+func (w *literalWriter) write(value interface{}, depth int) error {
+	switch v := value.(type) {
+	case nil:
+		w.buf.WriteString(w.pick("nil", "None", "null"))
+	case bool:
+		if v {
+			w.buf.WriteString(w.pick("true", "True", "true"))
+		} else {
+			w.buf.WriteString(w.pick("false", "False", "false"))
+		}
+	case string:
+		w.buf.WriteString(w.quote(v))
+	case int:
+		w.buf.WriteString(strconv.Itoa(v))
+	case int8, int16, int32, int64:
+		w.writeInt(fmt.Sprintf("%T", v), fmt.Sprint(v), math.Abs(float64(int64Value(v))) > 1<<53-1)
+	case uint8, uint16, uint32, uint64, uint:
+		w.writeInt(fmt.Sprintf("%T", v), fmt.Sprint(v), uint64Value(v) > 1<<53-1)
+	case float32:
+		w.writeFloat(float64(v), 32)
+	case float64:
+		w.writeFloat(v, 64)
+	case []byte:
+		w.writeBytes(v)
+	case time.Time:
+		w.writeTime(v)
+	case map[string]interface{}:
+		return w.writeMap(v, depth)
+	case []interface{}:
+		return w.writeSlice(v, depth)
+	default:
+		return fmt.Errorf("unsupported value of type %T", value)
+	}
+	return nil
+}
+
+func (w *literalWriter) pick(goLit, pyLit, tsLit string) string {
+	switch w.lang {
+	case FormatGo:
+		return goLit
+	case FormatPython:
+		return pyLit
+	default:
+		return tsLit
+	}
+}
+
+func (w *literalWriter) writeInt(typeName, digits string, unsafeInJS bool) {
+	switch {
+	case w.lang == FormatGo:
+		fmt.Fprintf(&w.buf, "%s(%s)", typeName, digits)
+	case w.lang == FormatTypeScript && unsafeInJS:
+		w.buf.WriteString(digits + "n")
+	default:
+		w.buf.WriteString(digits)
+	}
+}
+
+func (w *literalWriter) writeFloat(f float64, bits int) {
+	switch {
+	case math.IsNaN(f):
+		w.buf.WriteString(w.pick("math.NaN()", `float("nan")`, "NaN"))
+		return
+	case math.IsInf(f, 1):
+		w.buf.WriteString(w.pick("math.Inf(1)", `float("inf")`, "Infinity"))
+		return
+	case math.IsInf(f, -1):
+		w.buf.WriteString(w.pick("math.Inf(-1)", `float("-inf")`, "-Infinity"))
+		return
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if w.lang != FormatTypeScript && !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	if w.lang == FormatGo && bits == 32 {
+		s = "float32(" + s + ")"
+	}
+	w.buf.WriteString(s)
+}
+
+func (w *literalWriter) writeBytes(b []byte) {
+	switch w.lang {
+	case FormatGo:
+		if utf8.Valid(b) && isPrintableText(b) {
+			fmt.Fprintf(&w.buf, "[]byte(%s)", strconv.Quote(string(b)))
+			return
+		}
+		w.buf.WriteString("[]byte{")
+		for i, c := range b {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			fmt.Fprintf(&w.buf, "0x%02x", c)
+		}
+		w.buf.WriteString("}")
+	case FormatPython:
+		w.buf.WriteString(`b"`)
+		for _, c := range b {
+			switch {
+			case c == '\\' || c == '"':
+				w.buf.WriteByte('\\')
+				w.buf.WriteByte(c)
+			case c >= 0x20 && c < 0x7f:
+				w.buf.WriteByte(c)
+			default:
+				fmt.Fprintf(&w.buf, `\x%02x`, c)
+			}
+		}
+		w.buf.WriteString(`"`)
+	default:
+		w.buf.WriteString("new Uint8Array([")
+		for i, c := range b {
+			if i > 0 {
+				w.buf.WriteString(", ")
+			}
+			w.buf.WriteString(strconv.Itoa(int(c)))
+		}
+		w.buf.WriteString("])")
+	}
+}
+
+func (w *literalWriter) writeTime(t time.Time) {
+	t = t.UTC()
+	switch w.lang {
+	case FormatGo:
+		fmt.Fprintf(&w.buf, "time.Date(%d, time.%s, %d, %d, %d, %d, %d, time.UTC)",
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond())
+	case FormatPython:
+		fmt.Fprintf(&w.buf, "datetime.datetime(%d, %d, %d, %d, %d, %d, %d, tzinfo=datetime.timezone.utc)",
+			t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1000)
+	default:
+		fmt.Fprintf(&w.buf, "new Date(%q)", t.Format("2006-01-02T15:04:05.000Z"))
+	}
+}
+
+func (w *literalWriter) writeMap(m map[string]interface{}, depth int) error {
+	w.buf.WriteString(w.pick("map[string]interface{}{", "{", "{"))
+	if len(m) == 0 {
+		w.buf.WriteString("}")
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w.buf.WriteString("\n")
+	for _, key := range keys {
+		w.buf.WriteString(strings.Repeat(w.indent, depth+1))
+		if w.lang == FormatTypeScript && jsIdentifier.MatchString(key) {
+			w.buf.WriteString(key)
+		} else {
+			w.buf.WriteString(w.quote(key))
+		}
+		w.buf.WriteString(": ")
+		if err := w.write(m[key], depth+1); err != nil {
+			return err
+		}
+		w.buf.WriteString(",\n")
+	}
+	w.buf.WriteString(strings.Repeat(w.indent, depth) + "}")
+	return nil
+}
+
+func (w *literalWriter) writeSlice(items []interface{}, depth int) error {
+	open, closing := "[", "]"
+	if w.lang == FormatGo {
+		open, closing = "[]interface{}{", "}"
+	}
+	w.buf.WriteString(open)
+	if len(items) == 0 {
+		w.buf.WriteString(closing)
+		return nil
+	}
+
+	w.buf.WriteString("\n")
+	for _, item := range items {
+		w.buf.WriteString(strings.Repeat(w.indent, depth+1))
+		if err := w.write(item, depth+1); err != nil {
+			return err
+		}
+		w.buf.WriteString(",\n")
+	}
+	w.buf.WriteString(strings.Repeat(w.indent, depth) + closing)
+	return nil
+}
+
+func (w *literalWriter) quote(s string) string {
+	switch w.lang {
+	case FormatGo:
+		return strconv.Quote(s)
+	case FormatPython:
+		return pythonQuote(s)
+	default:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(s)
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+}
+
+func pythonQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '"':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		case !unicode.IsPrint(r):
+			if r > 0xffff {
+				fmt.Fprintf(&sb, `\U%08x`, r)
+			} else {
+				fmt.Fprintf(&sb, `\u%04x`, r)
+			}
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func int64Value(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return 0
+}
+
+func uint64Value(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint8:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	case uint32:
+		return uint64(n)
+	case uint64:
+		return n
+	case uint:
+		return uint64(n)
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -35,17 +36,64 @@ func run(args []string) error {
 		return fmt.Errorf("no arguments provided: %w", errUsage)
 	}
 
+	subcommand := ""
+	switch args[0] {
+	case "codegen":
+		return runCodegen(args[1:])
+	case "stats":
+		return runStats(args[1:])
+	case "compare-size":
+		return runCompareSize(args[1:])
+	case "view":
+		args = append([]string{"--view"}, args[1:]...)
+	case "convert":
+		args = args[1:]
+	case "watch":
+		args = append([]string{"--watch"}, args[1:]...)
+	case "browse":
+		subcommand, args = args[0], args[1:]
+	}
+
 	opts, err := parseArgs(args)
 	if err != nil {
 		return err
 	}
 
+	if opts.protoFile != "" {
+		opts.protoType, err = loadProtoMessage(opts.protoFile, opts.protoName)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.layoutFile != "" {
+		opts.layout, err = loadLayout(opts.layoutFile)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.extFile != "" {
+		opts.extTypes, err = loadExtRegistry(opts.extFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	switch {
+	case subcommand == "browse":
+		if len(opts.inputs) != 1 {
+			return fmt.Errorf("browse expects exactly one input file: %w", errUsage)
+		}
+		return opts.browseFile(opts.inputs[0])
 	case opts.view:
 		if len(opts.inputs) != 1 {
 			return fmt.Errorf("--view expects exactly one input file: %w", errUsage)
 		}
-		return viewFile(opts.inputs[0])
+		return opts.viewFile(opts.inputs[0])
+	case opts.watch:
+		if len(opts.inputs) == 0 {
+			return fmt.Errorf("no files or directories provided to watch: %w", errUsage)
+		}
+		return opts.watchFiles()
 	case opts.batchTarget != FormatUnknown:
 		if len(opts.inputs) == 0 {
 			return fmt.Errorf("no input files provided for batch conversion: %w", errUsage)
@@ -59,7 +107,7 @@ func run(args []string) error {
 		if err != nil {
 			return err
 		}
-		return convertToStdout(opts.inputs[0], fromFormat, opts.stdoutFormat)
+		return opts.convertToStdout(opts.inputs[0], fromFormat, opts.stdoutFormat)
 	default:
 		if len(opts.inputs) != 2 {
 			return fmt.Errorf("expected input and output files: %w", errUsage)
@@ -78,6 +126,15 @@ func parseArgs(args []string) (options, error) {
 			break
 		}
 
+		if value, ok := strings.CutPrefix(arg, "--color="); ok {
+			mode, err := parseColorMode(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.color = mode
+			continue
+		}
+
 		if strings.HasPrefix(arg, "-") {
 			switch arg {
 			case "-h", "--help":
@@ -94,6 +151,15 @@ func parseArgs(args []string) (options, error) {
 					return opts, fmt.Errorf("multiple stdout formats specified: %w", errUsage)
 				}
 				opts.stdoutFormat = FormatYAML
+			case "--go", "--python", "--ts":
+				if opts.stdoutFormat != FormatUnknown {
+					return opts, fmt.Errorf("multiple stdout formats specified: %w", errUsage)
+				}
+				format, err := parseFormat(strings.TrimPrefix(arg, "--"))
+				if err != nil {
+					return opts, err
+				}
+				opts.stdoutFormat = format
 			case "--from":
 				if i+1 >= len(args) {
 					return opts, fmt.Errorf("--from requires a format: %w", errUsage)
@@ -131,6 +197,215 @@ func parseArgs(args []string) (options, error) {
 					return opts, fmt.Errorf("multiple batch targets specified: %w", errUsage)
 				}
 				opts.batchTarget = FormatMsgpack
+			case "--force":
+				opts.force = true
+			case "--dry-run":
+				opts.dryRun = true
+			case "--backup":
+				opts.backup = true
+			case "--out-dir":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--out-dir requires a directory: %w", errUsage)
+				}
+				opts.outDir = args[i+1]
+				i++
+			case "-j", "--jobs":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("%s requires a number: %w", arg, errUsage)
+				}
+				jobs, err := parseWidth(arg, args[i+1], 1, 1<<16)
+				if err != nil {
+					return opts, err
+				}
+				opts.jobs = jobs
+				i++
+			case "--keep-going":
+				opts.keepGoing = true
+			case "--report":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--report requires a file: %w", errUsage)
+				}
+				opts.reportFile = args[i+1]
+				i++
+			case "--newer":
+				opts.newer = true
+			case "--manifest":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--manifest requires a file: %w", errUsage)
+				}
+				opts.manifestFile = args[i+1]
+				i++
+			case "--watch":
+				opts.watch = true
+				opts.recursive = true
+			case "-r", "--recursive":
+				opts.recursive = true
+			case "--include", "--exclude":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("%s requires a pattern: %w", arg, errUsage)
+				}
+				if err := checkGlob(args[i+1]); err != nil {
+					return opts, fmt.Errorf("%s: %v: %w", arg, err, errUsage)
+				}
+				if arg == "--include" {
+					opts.include = append(opts.include, args[i+1])
+				} else {
+					opts.exclude = append(opts.exclude, args[i+1])
+				}
+				i++
+			case "--out-archive":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--out-archive requires a file: %w", errUsage)
+				}
+				opts.outArchive = args[i+1]
+				i++
+			case "--out-template":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--out-template requires a template: %w", errUsage)
+				}
+				if err := checkOutTemplate(args[i+1]); err != nil {
+					return opts, err
+				}
+				opts.outTemplate = args[i+1]
+				i++
+			case "--compress", "--decompress":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("%s requires gzip, zstd, xz or none: %w", arg, errUsage)
+				}
+				c, err := parseCompression(args[i+1])
+				if err != nil {
+					return opts, err
+				}
+				if arg == "--compress" {
+					opts.compress = c
+				} else {
+					opts.decompress = c
+				}
+				i++
+			case "--compress-level":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--compress-level requires a number: %w", errUsage)
+				}
+				level, err := parseWidth(arg, args[i+1], 1, 22)
+				if err != nil {
+					return opts, err
+				}
+				opts.level = level
+				i++
+			case "--keep-comments":
+				opts.keepComments = true
+			case "--layout":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--layout requires a file: %w", errUsage)
+				}
+				opts.layoutFile = args[i+1]
+				i++
+			case "--ext-types":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--ext-types requires a file: %w", errUsage)
+				}
+				opts.extFile = args[i+1]
+				i++
+			case "--color":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--color requires always, never or auto: %w", errUsage)
+				}
+				mode, err := parseColorMode(args[i+1])
+				if err != nil {
+					return opts, err
+				}
+				opts.color = mode
+				i++
+			case "--tree":
+				opts.tree = true
+			case "--depth":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--depth requires a number: %w", errUsage)
+				}
+				depth, err := parseWidth(arg, args[i+1], 1, 1<<20)
+				if err != nil {
+					return opts, err
+				}
+				opts.treeDepth = depth
+				i++
+			case "--expand":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--expand requires a path: %w", errUsage)
+				}
+				if _, err := parsePath(args[i+1]); err != nil {
+					return opts, fmt.Errorf("%v: %w", err, errUsage)
+				}
+				opts.treeExpand = append(opts.treeExpand, args[i+1])
+				i++
+			case "--no-pager":
+				opts.noPager = true
+			case "--compact":
+				opts.style.compact = true
+			case "--tabs":
+				opts.style.tabs = true
+			case "--ascii":
+				opts.style.asciiOnly = true
+			case "--no-escape-html":
+				opts.style.noEscapeHTML = true
+			case "--indent", "--yaml-indent", "--yaml-flow":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("%s requires a number: %w", arg, errUsage)
+				}
+				var err error
+				switch arg {
+				case "--indent":
+					opts.style.indent, err = parseWidth(arg, args[i+1], 1, 16)
+				case "--yaml-indent":
+					opts.style.yamlIndent, err = parseWidth(arg, args[i+1], 2, 9)
+				default:
+					opts.style.yamlFlow, err = parseWidth(arg, args[i+1], 0, 1<<20)
+				}
+				if err != nil {
+					return opts, err
+				}
+				i++
+			case "--yaml-quote":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--yaml-quote requires a style: %w", errUsage)
+				}
+				quote, err := parseYAMLQuote(args[i+1])
+				if err != nil {
+					return opts, err
+				}
+				opts.style.yamlQuote = quote
+				i++
+			case "--input-encoding":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--input-encoding requires an encoding: %w", errUsage)
+				}
+				enc, err := parseEncoding(args[i+1])
+				if err != nil {
+					return opts, err
+				}
+				opts.inputEnc = enc
+				i++
+			case "--output-encoding":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--output-encoding requires an encoding: %w", errUsage)
+				}
+				enc, err := parseEncoding(args[i+1])
+				if err != nil {
+					return opts, err
+				}
+				opts.outputEnc = enc
+				i++
+			case "--proto-descriptor":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--proto-descriptor requires a file: %w", errUsage)
+				}
+				opts.protoFile = args[i+1]
+				i++
+			case "--proto-message":
+				if i+1 >= len(args) {
+					return opts, fmt.Errorf("--proto-message requires a message name: %w", errUsage)
+				}
+				opts.protoName = args[i+1]
+				i++
 			default:
 				return opts, fmt.Errorf("unknown flag %q: %w", arg, errUsage)
 			}
@@ -151,51 +426,66 @@ func parseArgs(args []string) (options, error) {
 	if opts.hasTo && opts.batchTarget != FormatUnknown {
 		return opts, fmt.Errorf("--to cannot be combined with --to-json/--to-yaml/--to-msgpack: %w", errUsage)
 	}
-
-	return opts, nil
-}
-
-func convertFilePair(inputPath, outputPath string, opts options) error {
-	fromFormat, err := opts.resolveFromFormat(inputPath)
-	if err != nil {
-		return err
+	if (opts.outDir != "" || opts.outTemplate != "") && opts.batchTarget == FormatUnknown {
+		return opts, fmt.Errorf("--out-dir and --out-template require --to-json/--to-yaml/--to-msgpack: %w", errUsage)
 	}
-
-	toFormat, err := opts.resolveToFormat(outputPath)
-	if err != nil {
-		return err
+	if opts.outArchive != "" && opts.batchTarget == FormatUnknown {
+		return opts, fmt.Errorf("--out-archive requires --to-json/--to-yaml/--to-msgpack: %w", errUsage)
+	}
+	if opts.newer && opts.manifestFile != "" {
+		return opts, fmt.Errorf("--newer cannot be combined with --manifest: %w", errUsage)
+	}
+	if opts.watch && opts.batchTarget == FormatUnknown {
+		return opts, fmt.Errorf("watch requires --to-json/--to-yaml/--to-msgpack: %w", errUsage)
+	}
+	if opts.watch && (opts.dryRun || opts.newer || opts.manifestFile != "" || opts.reportFile != "") {
+		return opts, fmt.Errorf("watch cannot be combined with --dry-run, --newer, --manifest or --report: %w", errUsage)
+	}
+	if opts.recursive && opts.batchTarget == FormatUnknown {
+		return opts, fmt.Errorf("-r requires --to-json/--to-yaml/--to-msgpack: %w", errUsage)
+	}
+	if (len(opts.include) > 0 || len(opts.exclude) > 0) && !opts.recursive && !hasArchive(opts.inputs) {
+		return opts, fmt.Errorf("--include and --exclude require -r or an archive input: %w", errUsage)
+	}
+	if opts.outArchive != "" && (opts.outDir != "" || opts.watch || opts.newer || opts.manifestFile != "") {
+		return opts, fmt.Errorf("--out-archive cannot be combined with --out-dir, watch, --newer or --manifest: %w", errUsage)
+	}
+	if (opts.tree || opts.treeDepth > 0 || len(opts.treeExpand) > 0) && !opts.view {
+		return opts, fmt.Errorf("--tree, --depth and --expand require --view: %w", errUsage)
+	}
+	if (opts.treeDepth > 0 || len(opts.treeExpand) > 0) && !opts.tree {
+		return opts, fmt.Errorf("--depth and --expand require --tree: %w", errUsage)
+	}
+	if opts.style.compact && (opts.style.tabs || opts.style.indent > 0) {
+		return opts, fmt.Errorf("--compact cannot be combined with --indent/--tabs: %w", errUsage)
+	}
+	if opts.protoName != "" && opts.protoFile == "" {
+		return opts, fmt.Errorf("--proto-message requires --proto-descriptor: %w", errUsage)
 	}
 
-	return convertAndWrite(inputPath, outputPath, fromFormat, toFormat)
+	return opts, nil
 }
 
-func batchConvert(opts options) error {
-	target := opts.batchTarget
-	for _, input := range opts.inputs {
-		fromFormat, err := opts.resolveFromFormat(input)
-		if err != nil {
-			return err
-		}
-		outputPath := deriveBatchDestination(input, target)
-		if err := convertAndWrite(input, outputPath, fromFormat, target); err != nil {
-			return err
-		}
-	}
-	return nil
+func readAndConvert(inputPath string, fromFormat, toFormat Format) ([]byte, error) {
+	return options{}.readAndConvert(inputPath, fromFormat, toFormat)
 }
 
-func readAndConvert(inputPath string, fromFormat, toFormat Format) ([]byte, error) {
-	data, err := os.ReadFile(inputPath)
+func (o options) readAndConvert(inputPath string, fromFormat, toFormat Format) ([]byte, error) {
+	data, err := o.readInput(inputPath)
 	if err != nil {
-		return nil, fmt.Errorf("read %s: %w", inputPath, err)
+		return nil, err
 	}
+	return o.convertInput(data, fromFormat, toFormat)
+}
 
-	converted, err := convertData(data, fromFormat, toFormat)
+// convertInput converts the uncompressed contents of an input file.
+func (o options) convertInput(data []byte, fromFormat, toFormat Format) ([]byte, error) {
+	converted, err := o.convertData(data, fromFormat, toFormat)
 	if err != nil {
 		return nil, fmt.Errorf("convert %s to %s: %w", fromFormat, toFormat, err)
 	}
 
-	if needsTrailingNewline(toFormat) {
+	if needsTrailingNewline(toFormat) || o.outputEnc != EncodingNone {
 		converted = appendNewline(converted)
 	}
 
@@ -203,34 +493,85 @@ func readAndConvert(inputPath string, fromFormat, toFormat Format) ([]byte, erro
 }
 
 func convertAndWrite(inputPath, outputPath string, fromFormat, toFormat Format) error {
-	converted, err := readAndConvert(inputPath, fromFormat, toFormat)
+	return options{}.convertAndWrite(inputPath, outputPath, fromFormat, toFormat)
+}
+
+func (o options) convertAndWrite(inputPath, outputPath string, fromFormat, toFormat Format) error {
+	return o.convertAndWriteContext(context.Background(), inputPath, outputPath, fromFormat, toFormat)
+}
+
+func (o options) convertAndWriteContext(ctx context.Context, inputPath, outputPath string, fromFormat, toFormat Format) error {
+	converted, err := o.readAndConvert(inputPath, fromFormat, toFormat)
 	if err != nil {
 		return err
 	}
+	return o.writeOutput(ctx, outputPath, converted)
+}
 
-	if err := os.WriteFile(outputPath, converted, 0o644); err != nil {
+// writeOutput compresses and writes converted data, leaving the output
+// untouched when ctx is cancelled first.
+func (o options) writeOutput(ctx context.Context, outputPath string, converted []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	converted, err := compressData(converted, o.outputCompression(outputPath), o.level)
+	if err != nil {
+		return fmt.Errorf("compress %s: %w", outputPath, err)
+	}
+
+	if err := writeFileAtomic(outputPath, converted, o.backup); err != nil {
 		return fmt.Errorf("write %s: %w", outputPath, err)
 	}
 
 	return nil
 }
 
-func convertToStdout(inputPath string, fromFormat, toFormat Format) error {
-	converted, err := readAndConvert(inputPath, fromFormat, toFormat)
+func (o options) convertToStdout(inputPath string, fromFormat, toFormat Format) error {
+	converted, err := o.readAndConvert(inputPath, fromFormat, toFormat)
 	if err != nil {
 		return err
 	}
+	if converted, err = compressData(converted, o.compress, o.level); err != nil {
+		return err
+	}
 
 	_, err = os.Stdout.Write(converted)
 	return err
 }
 
-func viewFile(inputPath string) error {
-	fromFormat, err := detectFormat(inputPath)
+func (o options) viewFile(inputPath string) error {
+	fromFormat, err := o.resolveFromFormat(inputPath)
+	if err != nil {
+		return err
+	}
+	if o.tree {
+		data, err := o.readInput(inputPath)
+		if err != nil {
+			return err
+		}
+		out, err := o.renderTree(data, fromFormat)
+		if err != nil {
+			return fmt.Errorf("render %s: %w", inputPath, err)
+		}
+		return o.writeView(out)
+	}
+	if !o.useColor() {
+		out, err := o.readAndConvert(inputPath, fromFormat, FormatJSON)
+		if err != nil {
+			return err
+		}
+		return o.writeView(out)
+	}
+
+	data, err := o.readInput(inputPath)
 	if err != nil {
 		return err
 	}
-	return convertToStdout(inputPath, fromFormat, FormatJSON)
+	out, err := o.renderColor(data, fromFormat)
+	if err != nil {
+		return fmt.Errorf("convert %s to %s: %w", fromFormat, FormatJSON, err)
+	}
+	return o.writeView(appendNewline(out))
 }
 
 func (f Format) String() string {
@@ -245,6 +586,20 @@ func (f Format) DefaultExt() string {
 		return "json"
 	case FormatYAML:
 		return "yaml"
+	case FormatJSONC:
+		return "jsonc"
+	case FormatJSON5:
+		return "json5"
+	case FormatPlist, FormatBinaryPlist:
+		return "plist"
+	case FormatProtowire:
+		return "pb"
+	case FormatGo:
+		return "go"
+	case FormatPython:
+		return "py"
+	case FormatTypeScript:
+		return "ts"
 	default:
 		return ""
 	}
@@ -258,33 +613,54 @@ func parseFormat(s string) (Format, error) {
 		return FormatJSON, nil
 	case "yaml", "yml":
 		return FormatYAML, nil
+	case "jsonc":
+		return FormatJSONC, nil
+	case "json5":
+		return FormatJSON5, nil
+	case "plist", "xmlplist":
+		return FormatPlist, nil
+	case "bplist", "binary-plist":
+		return FormatBinaryPlist, nil
+	case "protowire", "protobuf", "proto":
+		return FormatProtowire, nil
+	case "go", "golang":
+		return FormatGo, nil
+	case "python", "py":
+		return FormatPython, nil
+	case "ts", "typescript", "js", "javascript":
+		return FormatTypeScript, nil
 	default:
 		return FormatUnknown, fmt.Errorf("unknown format %q: %w", s, errUsage)
 	}
 }
 
 func detectFormat(path string) (Format, error) {
-	switch strings.ToLower(filepath.Ext(path)) {
+	switch strings.ToLower(filepath.Ext(trimCompressionExt(path))) {
 	case ".msgpack", ".mpk":
 		return FormatMsgpack, nil
 	case ".json":
 		return FormatJSON, nil
 	case ".yaml", ".yml":
 		return FormatYAML, nil
+	case ".jsonc":
+		return FormatJSONC, nil
+	case ".json5":
+		return FormatJSON5, nil
+	case ".plist":
+		return FormatPlist, nil
+	case ".pb":
+		return FormatProtowire, nil
+	case ".go":
+		return FormatGo, nil
+	case ".py":
+		return FormatPython, nil
+	case ".ts", ".js":
+		return FormatTypeScript, nil
 	default:
 		return FormatUnknown, fmt.Errorf("unable to infer format from %q: %w", path, errUsage)
 	}
 }
 
-func deriveBatchDestination(inputPath string, target Format) string {
-	base := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
-	ext := target.DefaultExt()
-	if ext == "" {
-		return inputPath
-	}
-	return base + "." + ext
-}
-
 func (o options) resolveFromFormat(path string) (Format, error) {
 	if o.hasFrom {
 		return o.from, nil
@@ -300,16 +676,85 @@ func (o options) resolveToFormat(path string) (Format, error) {
 }
 
 func convertData(data []byte, fromFormat, toFormat Format) ([]byte, error) {
+	return options{}.convertData(data, fromFormat, toFormat)
+}
+
+func (o options) convertData(data []byte, fromFormat, toFormat Format) ([]byte, error) {
 	if fromFormat == FormatUnknown || toFormat == FormatUnknown {
 		return nil, fmt.Errorf("unsupported conversion from %q to %q", fromFormat, toFormat)
 	}
 
-	value, err := decodeData(data, fromFormat)
+	data, err := decodeText(data, o.inputEnc)
 	if err != nil {
 		return nil, err
 	}
 
-	return encodeData(value, toFormat)
+	converted, err := o.transcode(data, fromFormat, toFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeText(converted, o.outputEnc)
+}
+
+func (o options) transcode(data []byte, fromFormat, toFormat Format) ([]byte, error) {
+	if o.keepComments && isJSON5Family(fromFormat) && toFormat == FormatYAML {
+		node, err := parseJSON5Node(data, fromFormat)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", fromFormat, err)
+		}
+		return o.style.encodeYAML(node)
+	}
+
+	value, err := o.decodeData(data, fromFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.layout != nil && fromFormat == FormatMsgpack {
+		if value, err = o.layout.expand(value); err != nil {
+			return nil, err
+		}
+	}
+	if o.layout != nil && toFormat == FormatMsgpack {
+		if value, err = o.layout.compact(value); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case toFormat != FormatMsgpack:
+		value, err = o.extTypes.unpack(value)
+	case o.extTypes != nil:
+		// Objects like {"$ext": ...} are only data unless --ext-types is given.
+		value, err = o.extTypes.pack(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o.encodeData(value, toFormat)
+}
+
+func (o options) encodeData(value interface{}, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON, FormatJSONC, FormatJSON5:
+		return o.style.encodeJSON(value)
+	case FormatYAML:
+		return o.style.encodeYAML(value)
+	default:
+		return encodeData(value, format)
+	}
+}
+
+func (o options) decodeData(data []byte, format Format) (interface{}, error) {
+	if format == FormatProtowire && o.protoType != nil {
+		value, err := decodeProtoMessage(data, o.protoType)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", o.protoType.FullName(), err)
+		}
+		return normalizeValue(value), nil
+	}
+	return decodeData(data, format)
 }
 
 func decodeData(data []byte, format Format) (interface{}, error) {
@@ -329,6 +774,26 @@ func decodeData(data []byte, format Format) (interface{}, error) {
 		if err := yaml.Unmarshal(data, &value); err != nil {
 			return nil, fmt.Errorf("decode yaml: %w", err)
 		}
+	case FormatJSONC, FormatJSON5:
+		decoded, err := decodeJSON5(data, format)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", format, err)
+		}
+		value = decoded
+	case FormatPlist, FormatBinaryPlist:
+		decoded, err := decodePlist(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode plist: %w", err)
+		}
+		value = decoded
+	case FormatProtowire:
+		decoded, err := decodeProtowire(data)
+		if err != nil {
+			return nil, fmt.Errorf("decode protowire: %w", err)
+		}
+		value = decoded
+	case FormatGo, FormatPython, FormatTypeScript:
+		return nil, fmt.Errorf("%s is an output-only format", format)
 	default:
 		return nil, fmt.Errorf("unsupported format %q", format)
 	}
@@ -339,10 +804,16 @@ func encodeData(value interface{}, format Format) ([]byte, error) {
 	switch format {
 	case FormatMsgpack:
 		return msgpack.Marshal(value)
-	case FormatJSON:
-		return json.MarshalIndent(value, "", "  ")
+	case FormatJSON, FormatJSONC, FormatJSON5:
+		return outputStyle{}.encodeJSON(value)
 	case FormatYAML:
-		return yaml.Marshal(value)
+		return outputStyle{}.encodeYAML(value)
+	case FormatPlist, FormatBinaryPlist:
+		return encodePlist(value, format)
+	case FormatProtowire:
+		return nil, fmt.Errorf("protowire is an input-only format")
+	case FormatGo, FormatPython, FormatTypeScript:
+		return encodeLiteral(value, format)
 	default:
 		return nil, fmt.Errorf("unsupported format %q", format)
 	}
@@ -380,7 +851,16 @@ func normalizeValue(value interface{}) interface{} {
 }
 
 func needsTrailingNewline(format Format) bool {
-	return format == FormatJSON || format == FormatYAML
+	switch format {
+	case FormatJSON, FormatYAML, FormatJSONC, FormatJSON5, FormatPlist, FormatGo, FormatPython, FormatTypeScript:
+		return true
+	default:
+		return false
+	}
+}
+
+func isJSON5Family(format Format) bool {
+	return format == FormatJSONC || format == FormatJSON5
 }
 
 func appendNewline(data []byte) []byte {
@@ -394,19 +874,100 @@ func printUsage(w io.Writer) {
 	fmt.Fprintln(w, "mpt v"+versionText)
 	fmt.Fprintln(w, "usage:")
 	fmt.Fprintln(w, "  mpt --view file.msgpack")
+	fmt.Fprintln(w, "  mpt view --tree --depth 2 --expand '$.items[0]' file.msgpack")
+	fmt.Fprintln(w, "  mpt browse big.msgpack")
 	fmt.Fprintln(w, "  mpt input.msgpack output.json")
 	fmt.Fprintln(w, "  mpt --from msgpack --to json input.bin output.txt")
 	fmt.Fprintln(w, "  mpt data.msgpack --json")
+	fmt.Fprintln(w, "  mpt --keep-comments config.jsonc config.yaml")
+	fmt.Fprintln(w, "  mpt --to bplist settings.msgpack settings.plist")
+	fmt.Fprintln(w, "  mpt --from protowire --proto-descriptor api.desc payload.bin --json")
+	fmt.Fprintln(w, "  mpt --from msgpack --input-encoding hex payload.txt --json")
+	fmt.Fprintln(w, "  mpt fixture.msgpack --go")
 	fmt.Fprintln(w, "  mpt *.msgpack --to-json")
+	fmt.Fprintln(w, "  mpt watch src/ --to-msgpack")
+	fmt.Fprintln(w, "  mpt bundle.tar.gz --to-json --out-archive bundle-json.zip")
+	fmt.Fprintln(w, "  mpt convert -r configs/ --to-msgpack --include '*.yaml' --exclude 'vendor/**'")
+	fmt.Fprintln(w, "  mpt codegen go|ts|python|rust *.msgpack --package feeds --type Event")
+	fmt.Fprintln(w, "  mpt stats --top 10 --json file.msgpack")
+	fmt.Fprintln(w, "  mpt compare-size --compress gzip,zstd data.json")
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "options:")
 	fmt.Fprintln(w, "  -h, --help          show this help message")
 	fmt.Fprintln(w, "  -v, --view          render messagepack as json to stdout")
+	fmt.Fprintln(w, "      --color when    color --view output: always, never or auto (default)")
+	fmt.Fprintln(w, "      --tree          render --view output as a collapsed tree")
+	fmt.Fprintln(w, "      --depth n       levels to show in --tree (default 2)")
+	fmt.Fprintln(w, "      --expand path   open a path in --tree regardless of depth")
+	fmt.Fprintln(w, "      --no-pager      do not page long --view output through $PAGER")
 	fmt.Fprintln(w, "      --json          convert input to json and write to stdout")
 	fmt.Fprintln(w, "      --yaml          convert input to yaml and write to stdout")
+	fmt.Fprintln(w, "      --go, --python, --ts")
+	fmt.Fprintln(w, "                      write input as a go, python or typescript literal to stdout")
 	fmt.Fprintln(w, "      --from format   override detected input format")
 	fmt.Fprintln(w, "      --to format     override detected output format for single conversion")
 	fmt.Fprintln(w, "      --to-json       batch convert input files to json files")
 	fmt.Fprintln(w, "      --to-yaml       batch convert input files to yaml files")
 	fmt.Fprintln(w, "      --to-msgpack    batch convert input files to messagepack files")
+	fmt.Fprintln(w, "      --force         overwrite existing output files")
+	fmt.Fprintln(w, "      --dry-run       list the files a conversion would write")
+	fmt.Fprintln(w, "      --backup        keep replaced output files as file.bak")
+	fmt.Fprintln(w, "      --watch         reconvert batch inputs whenever they change")
+	fmt.Fprintln(w, "  -j, --jobs n        files to convert at once in batch mode (default: cpu count)")
+	fmt.Fprintln(w, "      --keep-going    convert every file despite failures, then print a summary")
+	fmt.Fprintln(w, "      --report file   write a json report of the conversion to file")
+	fmt.Fprintln(w, "      --newer         skip inputs older than their outputs")
+	fmt.Fprintln(w, "      --manifest file skip inputs whose hash in the manifest file is unchanged")
+	fmt.Fprintln(w, "  -r, --recursive     convert files in directories given as batch inputs")
+	fmt.Fprintln(w, "      --include glob  with -r, convert only matching files (repeatable)")
+	fmt.Fprintln(w, "      --exclude glob  with -r, skip matching files and directories (repeatable)")
+	fmt.Fprintln(w, "      --out-dir dir   write batch outputs under dir, mirroring the input tree")
+	fmt.Fprintln(w, "      --out-archive file")
+	fmt.Fprintln(w, "                      write a tar or zip input to a new archive with converted members")
+	fmt.Fprintln(w, "      --out-template template")
+	fmt.Fprintln(w, "                      name batch outputs from {dir}, {name} and {ext}")
+	fmt.Fprintln(w, "      --compress c    compress outputs with gzip, zstd, xz or none")
+	fmt.Fprintln(w, "                      (default: from the output extension, like out.json.gz)")
+	fmt.Fprintln(w, "      --decompress c  read inputs as gzip, zstd, xz or none (default: detected)")
+	fmt.Fprintln(w, "      --compress-level n")
+	fmt.Fprintln(w, "                      compression level: 1-9 for gzip and xz, 1-22 for zstd")
+	fmt.Fprintln(w, "      --keep-comments keep jsonc/json5 comments when writing yaml")
+	fmt.Fprintln(w, "      --layout file   name positional msgpack arrays using a layout file")
+	fmt.Fprintln(w, "      --ext-types file")
+	fmt.Fprintln(w, "                      render msgpack ext types using a registry file")
+	fmt.Fprintln(w, "      --compact       write json on a single line")
+	fmt.Fprintln(w, "      --indent n      indent json by n spaces (default 2)")
+	fmt.Fprintln(w, "      --tabs          indent json with tabs")
+	fmt.Fprintln(w, "      --ascii         escape non-ascii characters in json")
+	fmt.Fprintln(w, "      --no-escape-html")
+	fmt.Fprintln(w, "                      write <, > and & in json strings as is")
+	fmt.Fprintln(w, "      --yaml-indent n indent yaml by n spaces (default 4)")
+	fmt.Fprintln(w, "      --yaml-flow n   write yaml sequences of up to n scalars inline")
+	fmt.Fprintln(w, "      --yaml-quote style")
+	fmt.Fprintln(w, "                      quote yaml strings: plain, single or double")
+	fmt.Fprintln(w, "      --input-encoding enc")
+	fmt.Fprintln(w, "                      read input as hex, base64 or base64url text")
+	fmt.Fprintln(w, "      --output-encoding enc")
+	fmt.Fprintln(w, "                      write output as hex, base64 or base64url text")
+	fmt.Fprintln(w, "      --proto-descriptor file")
+	fmt.Fprintln(w, "                      decode protowire input with a protoc descriptor set")
+	fmt.Fprintln(w, "      --proto-message name")
+	fmt.Fprintln(w, "                      message type to decode protowire input as")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "codegen options:")
+	fmt.Fprintln(w, "      --package name  package for generated go code (default models)")
+	fmt.Fprintln(w, "      --type name     name of the top-level type (default from first file)")
+	fmt.Fprintln(w, "      --typeddict     generate python TypedDicts instead of dataclasses")
+	fmt.Fprintln(w, "      --from format   override detected sample format")
+	fmt.Fprintln(w, "  -o, --output file   write generated code to file instead of stdout")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "stats options:")
+	fmt.Fprintln(w, "      --top n         paths to list by size, 0 for all (default 20)")
+	fmt.Fprintln(w, "      --json          write the report as json")
+	fmt.Fprintln(w, "      --from format   override detected input format")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "compare-size options:")
+	fmt.Fprintln(w, "      --compress list also compare compressed sizes, e.g. gzip,zstd,xz")
+	fmt.Fprintln(w, "      --runs n        average timings over n runs (default 5)")
+	fmt.Fprintln(w, "      --from format   override detected input format")
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is one step of a JSONPath-style location such as
+// `$.items[*].name`. A segment is either an object key, an array index, or a
+// wildcard over all array elements.
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func keySegment(key string) pathSegment {
+	return pathSegment{key: key}
+}
+
+func indexSegment(i int) pathSegment {
+	return pathSegment{index: i, isIndex: true}
+}
+
+// parsePath accepts `$`, `.key`, `["key"]`, `[N]` and `[*]` segments. The
+// leading `$` is optional.
+func parsePath(s string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "$")
+	if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var segments []pathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("invalid path %q: empty key", s)
+			}
+			if key == "*" {
+				segments = append(segments, pathSegment{wildcard: true})
+			} else {
+				segments = append(segments, keySegment(key))
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated [", s)
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			case strings.HasPrefix(inner, `"`) || strings.HasPrefix(inner, "'"):
+				key, err := strconv.Unquote(`"` + strings.Trim(inner, `"'`) + `"`)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: bad quoted key %s", s, inner)
+				}
+				segments = append(segments, keySegment(key))
+			default:
+				i, err := strconv.Atoi(inner)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("invalid path %q: bad index %s", s, inner)
+				}
+				segments = append(segments, indexSegment(i))
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", s, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// formatPath renders segments back into `$.key[0]` form.
+func formatPath(segments []pathSegment) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, seg := range segments {
+		switch {
+		case seg.wildcard:
+			sb.WriteString("[*]")
+		case seg.isIndex:
+			fmt.Fprintf(&sb, "[%d]", seg.index)
+		case isPlainPathKey(seg.key):
+			sb.WriteString("." + seg.key)
+		default:
+			fmt.Fprintf(&sb, "[%s]", strconv.Quote(seg.key))
+		}
+	}
+	return sb.String()
+}
+
+func isPlainPathKey(key string) bool {
+	if key == "" || key == "*" {
+		return false
+	}
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r == '$' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r > 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPath reports whether a concrete path matches a pattern that may use
+// wildcards for array elements.
+func matchPath(pattern, path []pathSegment) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i, seg := range pattern {
+		actual := path[i]
+		switch {
+		case seg.wildcard:
+			continue
+		case seg.isIndex:
+			if !actual.isIndex || actual.index != seg.index {
+				return false
+			}
+		default:
+			if actual.isIndex || actual.key != seg.key {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// appendPath returns a copy of path extended by seg, so that callers can keep
+// the parent path for siblings.
+func appendPath(path []pathSegment, seg pathSegment) []pathSegment {
+	out := make([]pathSegment, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, seg)
+}
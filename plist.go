@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"howett.net/plist"
+)
+
+// decodePlist reads XML, binary and OpenStep property lists. Binary data
+// decodes to []byte and dates to time.Time, which msgpack encodes as bin and
+// timestamp values respectively.
+func decodePlist(data []byte) (interface{}, error) {
+	var value interface{}
+	if _, err := plist.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func encodePlist(value interface{}, format Format) ([]byte, error) {
+	if err := checkPlistValue(value, "$"); err != nil {
+		return nil, err
+	}
+	if format == FormatBinaryPlist {
+		return plist.Marshal(value, plist.BinaryFormat)
+	}
+	return plist.MarshalIndent(value, plist.XMLFormat, "\t")
+}
+
+// checkPlistValue rejects values that a property list cannot hold, since the
+// plist encoder silently drops them.
+func checkPlistValue(value interface{}, path string) error {
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("plist cannot represent null at %s", path)
+	case map[string]interface{}:
+		for key, val := range v {
+			if err := checkPlistValue(val, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			if err := checkPlistValue(val, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// maxProtoDepth bounds how far length-delimited fields are speculatively
+// parsed as nested messages.
+const maxProtoDepth = 64
+
+// decodeProtowire decodes protobuf wire-format bytes without a schema. Each
+// message becomes a list of {field, wire, value} entries in wire order, and
+// length-delimited values are shown as strings, nested messages or raw bytes
+// depending on what their contents look like.
+func decodeProtowire(data []byte) (interface{}, error) {
+	return parseProtoFields(data, 0)
+}
+
+func parseProtoFields(b []byte, depth int) ([]interface{}, error) {
+	fields := []interface{}{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var value interface{}
+		var wire string
+		switch typ {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			value, wire = v, "varint"
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			value, wire = v, "fixed32"
+		case protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			value, wire = v, "fixed64"
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			value, wire = guessProtoBytes(v, depth), "bytes"
+		case protowire.StartGroupType:
+			var v []byte
+			v, n = protowire.ConsumeGroup(num, b)
+			if n >= 0 {
+				nested, err := parseProtoFields(v, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				value = nested
+			}
+			wire = "group"
+		default:
+			return nil, fmt.Errorf("unexpected wire type %d for field %d", typ, num)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		fields = append(fields, map[string]interface{}{
+			"field": int64(num),
+			"wire":  wire,
+			"value": value,
+		})
+	}
+	return fields, nil
+}
+
+// guessProtoBytes picks the most plausible reading of a length-delimited
+// field: bytes that parse cleanly are a nested message, printable UTF-8 is
+// a string, and anything else stays binary. The message is tried first
+// because small messages, like a single string field, are often printable.
+func guessProtoBytes(b []byte, depth int) interface{} {
+	if len(b) == 0 {
+		return ""
+	}
+	if depth < maxProtoDepth {
+		if nested, err := parseProtoFields(b, depth+1); err == nil {
+			return nested
+		}
+	}
+	if isPrintableText(b) {
+		return string(b)
+	}
+	return b
+}
+
+func isPrintableText(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// loadProtoMessage finds the message type to decode with in a descriptor set
+// produced by `protoc --include_imports --descriptor_set_out`. The name may be
+// omitted when the set defines a single message.
+func loadProtoMessage(path, name string) (protoreflect.MessageDescriptor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("load descriptor set %s: %w", path, err)
+	}
+
+	if name == "" {
+		var names []string
+		files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+			messages := fd.Messages()
+			for i := 0; i < messages.Len(); i++ {
+				names = append(names, string(messages.Get(i).FullName()))
+			}
+			return true
+		})
+		if len(names) != 1 {
+			sort.Strings(names)
+			return nil, fmt.Errorf("--proto-message is required, %s defines: %s: %w", path, strings.Join(names, ", "), errUsage)
+		}
+		name = names[0]
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("find message %q in %s: %w", name, path, err)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q in %s is not a message", name, path)
+	}
+	return md, nil
+}
+
+func decodeProtoMessage(data []byte, md protoreflect.MessageDescriptor) (interface{}, error) {
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return protoMessageValue(msg), nil
+}
+
+func protoMessageValue(m protoreflect.Message) interface{} {
+	if m.Descriptor().FullName() == "google.protobuf.Timestamp" {
+		fields := m.Descriptor().Fields()
+		seconds := m.Get(fields.ByName("seconds")).Int()
+		nanos := m.Get(fields.ByName("nanos")).Int()
+		return time.Unix(seconds, nanos).UTC()
+	}
+
+	out := make(map[string]interface{})
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		out[string(fd.Name())] = protoFieldValue(fd, v)
+		return true
+	})
+	return out
+}
+
+func protoFieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]interface{}, list.Len())
+		for i := range items {
+			items[i] = protoScalarValue(fd, list.Get(i))
+		}
+		return items
+	case fd.IsMap():
+		out := make(map[string]interface{})
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			out[k.String()] = protoScalarValue(fd.MapValue(), mv)
+			return true
+		})
+		return out
+	default:
+		return protoScalarValue(fd, v)
+	}
+}
+
+func protoScalarValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int64(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return protoMessageValue(v.Message())
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func runStats(args []string) error {
+	opts, err := parseStatsArgs(args)
+	if err != nil {
+		return err
+	}
+
+	report, err := collectStats(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(appendNewline(out))
+		return err
+	}
+	return report.write(os.Stdout)
+}
+
+func parseStatsArgs(args []string) (statsOptions, error) {
+	opts := statsOptions{top: 20}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.inputs = append(opts.inputs, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			opts.inputs = append(opts.inputs, arg)
+			continue
+		}
+
+		switch arg {
+		case "-h", "--help":
+			return opts, errHelp
+		case "--json":
+			opts.json = true
+		case "--from", "--top":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("%s requires a value: %w", arg, errUsage)
+			}
+			value := args[i+1]
+			i++
+			if arg == "--top" {
+				top, err := parseWidth(arg, value, 0, 1<<30)
+				if err != nil {
+					return opts, err
+				}
+				opts.top = top
+				continue
+			}
+			format, err := parseFormat(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.from = format
+		default:
+			return opts, fmt.Errorf("unknown stats flag %q: %w", arg, errUsage)
+		}
+	}
+
+	if len(opts.inputs) != 1 {
+		return opts, fmt.Errorf("stats expects exactly one input file: %w", errUsage)
+	}
+	return opts, nil
+}
+
+type statsReport struct {
+	File       string           `json:"file"`
+	Format     Format           `json:"format"`
+	TotalBytes int64            `json:"total_bytes"`
+	Documents  int64            `json:"documents"`
+	MaxDepth   int              `json:"max_depth"`
+	Values     int64            `json:"values"`
+	Keys       int64            `json:"keys"`
+	Types      map[string]int64 `json:"types"`
+	Strings    lengthStats      `json:"strings"`
+	Binaries   lengthStats      `json:"binaries"`
+	Paths      []pathStats      `json:"paths"`
+}
+
+type lengthStats struct {
+	Count int64   `json:"count"`
+	Total int64   `json:"total"`
+	Min   int64   `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   int64   `json:"p50"`
+	P90   int64   `json:"p90"`
+	P99   int64   `json:"p99"`
+	Max   int64   `json:"max"`
+}
+
+// pathStats is the encoded size of every value at a path, with array
+// indices folded into [*].
+type pathStats struct {
+	Path    string  `json:"path"`
+	Bytes   int64   `json:"bytes"`
+	Percent float64 `json:"percent"`
+	Count   int64   `json:"count"`
+}
+
+// statsCollector walks msgpack headers without decoding values, so large
+// files are measured without holding them in memory.
+type statsCollector struct {
+	doc      *pagedReader
+	report   *statsReport
+	strings  []int64
+	binaries []int64
+	paths    map[string]*pathStats
+}
+
+func collectStats(opts statsOptions) (*statsReport, error) {
+	input := opts.inputs[0]
+	fromFormat := opts.from
+	if fromFormat == FormatUnknown {
+		detected, err := detectFormat(input)
+		if err != nil {
+			return nil, err
+		}
+		fromFormat = detected
+	}
+
+	compressed, err := options{}.inputCompressed(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.ReaderAt
+	var size int64
+	if fromFormat == FormatMsgpack && !compressed {
+		f, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		r, size = f, info.Size()
+	} else if fromFormat == FormatMsgpack {
+		data, err := options{}.readInput(input)
+		if err != nil {
+			return nil, err
+		}
+		r, size = bytes.NewReader(data), int64(len(data))
+	} else {
+		// Other formats are measured by their msgpack encoding.
+		converted, err := options{}.readAndConvert(input, fromFormat, FormatMsgpack)
+		if err != nil {
+			return nil, err
+		}
+		r, size = bytes.NewReader(converted), int64(len(converted))
+	}
+
+	c := &statsCollector{
+		doc:    newPagedReader(r, size),
+		report: &statsReport{File: input, Format: fromFormat, TotalBytes: size, Types: make(map[string]int64)},
+		paths:  make(map[string]*pathStats),
+	}
+	// A file may hold a stream of messages; each one is measured at $.
+	for off := int64(0); off < size; c.report.Documents++ {
+		end, err := c.walk(off, "$", 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+		off = end
+	}
+
+	c.report.Strings = summarizeLengths(c.strings)
+	c.report.Binaries = summarizeLengths(c.binaries)
+	for _, p := range c.paths {
+		if size > 0 {
+			p.Percent = math.Round(float64(p.Bytes)*10000/float64(size)) / 100
+		}
+		c.report.Paths = append(c.report.Paths, *p)
+	}
+	sort.Slice(c.report.Paths, func(i, j int) bool {
+		a, b := c.report.Paths[i], c.report.Paths[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Path < b.Path
+	})
+	if opts.top > 0 && len(c.report.Paths) > opts.top {
+		c.report.Paths = c.report.Paths[:opts.top]
+	}
+	return c.report, nil
+}
+
+func (c *statsCollector) walk(off int64, path string, depth int) (int64, error) {
+	h, err := c.doc.header(off)
+	if err != nil {
+		return 0, err
+	}
+	c.report.Values++
+	c.report.MaxDepth = max(c.report.MaxDepth, depth)
+
+	end := off + h.size
+	switch h.kind {
+	case msgArray:
+		for i := int64(0); i < h.length; i++ {
+			if end, err = c.walk(end, path+"[*]", depth+1); err != nil {
+				return 0, err
+			}
+		}
+	case msgMap:
+		c.report.Keys += h.length
+		for i := int64(0); i < h.length; i++ {
+			key, valueOff, err := c.doc.readKey(end)
+			if err != nil {
+				return 0, err
+			}
+			if end, err = c.walk(valueOff, path+formatPath([]pathSegment{keySegment(key)})[1:], depth+1); err != nil {
+				return 0, err
+			}
+		}
+	default:
+		end += h.length
+		switch h.kind {
+		case msgStr:
+			c.strings = append(c.strings, h.length)
+		case msgBin:
+			c.binaries = append(c.binaries, h.length)
+		}
+	}
+
+	c.report.Types[statsTypeName(h)]++
+	p, ok := c.paths[path]
+	if !ok {
+		p = &pathStats{Path: path}
+		c.paths[path] = p
+	}
+	p.Bytes += end - off
+	p.Count++
+	return end, nil
+}
+
+func statsTypeName(h msgHeader) string {
+	switch h.kind {
+	case msgNil:
+		return "nil"
+	case msgBool:
+		return "bool"
+	case msgInt, msgUint:
+		return "int"
+	case msgFloat:
+		return "float"
+	case msgStr:
+		return "str"
+	case msgBin:
+		return "bin"
+	case msgExt:
+		if h.ext == -1 {
+			return "timestamp"
+		}
+		return "ext"
+	case msgArray:
+		return "array"
+	default:
+		return "map"
+	}
+}
+
+func summarizeLengths(lengths []int64) lengthStats {
+	if len(lengths) == 0 {
+		return lengthStats{}
+	}
+	sort.Slice(lengths, func(i, j int) bool { return lengths[i] < lengths[j] })
+	s := lengthStats{Count: int64(len(lengths)), Min: lengths[0], Max: lengths[len(lengths)-1]}
+	for _, n := range lengths {
+		s.Total += n
+	}
+	s.Mean = float64(s.Total) / float64(s.Count)
+	percentile := func(p int) int64 {
+		return lengths[(len(lengths)-1)*p/100]
+	}
+	s.P50, s.P90, s.P99 = percentile(50), percentile(90), percentile(99)
+	return s
+}
+
+func (r *statsReport) write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "file:\t%s (%s)\n", r.File, r.Format)
+	if r.Format != FormatMsgpack {
+		fmt.Fprintf(tw, "size:\t%s as msgpack\n", plural(int(r.TotalBytes), "byte"))
+	} else {
+		fmt.Fprintf(tw, "size:\t%s\n", plural(int(r.TotalBytes), "byte"))
+	}
+	if r.Documents != 1 {
+		fmt.Fprintf(tw, "documents:\t%d\n", r.Documents)
+	}
+	fmt.Fprintf(tw, "max depth:\t%d\n", r.MaxDepth)
+	fmt.Fprintf(tw, "values:\t%d\n", r.Values)
+	fmt.Fprintf(tw, "map keys:\t%d\n", r.Keys)
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "types:")
+	names := make([]string, 0, len(r.Types))
+	for name := range r.Types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.Types[names[i]] != r.Types[names[j]] {
+			return r.Types[names[i]] > r.Types[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%d\n", name, r.Types[name])
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "lengths:")
+	fmt.Fprintln(tw, "\tcount\ttotal\tmin\tmean\tp50\tp90\tp99\tmax")
+	for _, row := range []struct {
+		name string
+		s    lengthStats
+	}{{"str", r.Strings}, {"bin", r.Binaries}} {
+		s := row.s
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%d\t%.1f\t%d\t%d\t%d\t%d\n", row.name, s.Count, s.Total, s.Min, s.Mean, s.P50, s.P90, s.P99, s.Max)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "bytes by path:")
+	for _, p := range r.Paths {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", strconv.FormatFloat(p.Percent, 'f', 1, 64)+"%", strconv.FormatInt(p.Bytes, 10), p.Path, plural(int(p.Count), "value"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestStats(t *testing.T) {
+	dir := setupTestDir(t)
+
+	items := make([]interface{}, 4)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": i, "thumb": bytes.Repeat([]byte{1}, 100)}
+	}
+	data, err := msgpack.Marshal(map[string]interface{}{"items": items, "name": "abc"})
+	if err != nil {
+		t.Fatalf("failed to marshal fixture: %v", err)
+	}
+	input := filepath.Join(dir, "data.msgpack")
+	// Two messages back to back are measured as a stream.
+	writeTestFile(t, input, append(data, data...))
+
+	report, err := collectStats(statsOptions{top: 3, inputs: []string{input}})
+	if err != nil {
+		t.Fatalf("collectStats failed: %v", err)
+	}
+	if report.TotalBytes != int64(2*len(data)) || report.Documents != 2 || report.MaxDepth != 3 {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+	if report.Types["bin"] != 8 || report.Types["map"] != 10 || report.Keys != 20 {
+		t.Errorf("unexpected counts: types %v, keys %d", report.Types, report.Keys)
+	}
+	if report.Binaries.Count != 8 || report.Binaries.Max != 100 || report.Strings.Total != 6 {
+		t.Errorf("unexpected lengths: bin %+v, str %+v", report.Binaries, report.Strings)
+	}
+	if len(report.Paths) != 3 || report.Paths[0].Path != "$" || report.Paths[2].Path != "$.items[*]" {
+		t.Fatalf("unexpected paths: %+v", report.Paths)
+	}
+
+	report, err = collectStats(statsOptions{inputs: []string{input}})
+	if err != nil {
+		t.Fatalf("collectStats failed: %v", err)
+	}
+	var thumb pathStats
+	for _, p := range report.Paths {
+		if p.Path == "$.items[*].thumb" {
+			thumb = p
+		}
+	}
+	if thumb.Count != 8 || thumb.Bytes != 8*102 || thumb.Percent < 80 {
+		t.Errorf("unexpected thumbnail share: %+v", thumb)
+	}
+
+	var out bytes.Buffer
+	if err := report.write(&out); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "$.items[*].thumb") || !strings.Contains(out.String(), "documents:  2") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	_, err = parseStatsArgs([]string{"a.msgpack", "b.msgpack"})
+	assertError(t, err, "exactly one input")
+}
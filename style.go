@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputStyle controls how JSON and YAML output is laid out. The zero value
+// matches the historical output: two-space indented JSON with HTML escaping,
+// and yaml.v3 defaults.
+type outputStyle struct {
+	compact      bool
+	indent       int
+	tabs         bool
+	asciiOnly    bool
+	noEscapeHTML bool
+	yamlIndent   int
+	yamlFlow     int
+	yamlQuote    yaml.Style
+}
+
+func parseYAMLQuote(s string) (yaml.Style, error) {
+	switch s {
+	case "plain", "auto":
+		return 0, nil
+	case "single":
+		return yaml.SingleQuotedStyle, nil
+	case "double":
+		return yaml.DoubleQuotedStyle, nil
+	default:
+		return 0, fmt.Errorf("unknown quoting style %q (want plain, single or double): %w", s, errUsage)
+	}
+}
+
+// parseWidth parses the numeric argument of an indentation flag.
+func parseWidth(flag, s string, min, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s expects a number from %d to %d: %w", flag, min, max, errUsage)
+	}
+	return n, nil
+}
+
+func (s outputStyle) encodeJSON(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(!s.noEscapeHTML)
+	switch {
+	case s.compact:
+	case s.tabs:
+		enc.SetIndent("", "\t")
+	case s.indent > 0:
+		enc.SetIndent("", string(bytes.Repeat([]byte(" "), s.indent)))
+	default:
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+
+	out := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if s.asciiOnly {
+		out = escapeNonASCII(out)
+	}
+	return out, nil
+}
+
+// escapeNonASCII rewrites every non-ASCII rune in encoded JSON as a \u
+// escape. Such runes can only appear inside strings, so this is safe to do
+// on the encoded bytes.
+func escapeNonASCII(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			out = append(out, data[i])
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			out = fmt.Appendf(out, `\u%04x\u%04x`, r1, r2)
+		} else {
+			out = fmt.Appendf(out, `\u%04x`, r)
+		}
+		i += size
+	}
+	return out
+}
+
+// encodeYAML accepts either a plain value or a *yaml.Node, as produced when
+// comments are kept.
+func (s outputStyle) encodeYAML(value interface{}) ([]byte, error) {
+	node, ok := value.(*yaml.Node)
+	if !ok {
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if s == (outputStyle{}) {
+			return data, nil
+		}
+		node = &yaml.Node{}
+		if err := yaml.Unmarshal(data, node); err != nil {
+			return nil, err
+		}
+	}
+	s.styleNode(node, false)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	if s.yamlIndent > 0 {
+		enc.SetIndent(s.yamlIndent)
+	}
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// styleNode applies flow style to short scalar sequences and the quoting
+// style to string values. Mapping keys keep their default style.
+func (s outputStyle) styleNode(node *yaml.Node, isKey bool) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			s.styleNode(child, false)
+		}
+	case yaml.MappingNode:
+		for i, child := range node.Content {
+			s.styleNode(child, i%2 == 0)
+		}
+	case yaml.SequenceNode:
+		scalars := true
+		for _, child := range node.Content {
+			s.styleNode(child, false)
+			if child.Kind != yaml.ScalarNode {
+				scalars = false
+			}
+		}
+		if scalars && len(node.Content) <= s.yamlFlow {
+			node.Style |= yaml.FlowStyle
+		}
+	case yaml.ScalarNode:
+		if !isKey && s.yamlQuote != 0 && node.Tag == "!!str" && node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Style = s.yamlQuote
+		}
+	}
+}
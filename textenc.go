@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+func (e Encoding) String() string {
+	return string(e)
+}
+
+func parseEncoding(s string) (Encoding, error) {
+	switch strings.ToLower(s) {
+	case "hex":
+		return EncodingHex, nil
+	case "base64", "b64":
+		return EncodingBase64, nil
+	case "base64url", "b64url":
+		return EncodingBase64URL, nil
+	default:
+		return EncodingNone, fmt.Errorf("unknown encoding %q: %w", s, errUsage)
+	}
+}
+
+// decodeText turns a hex or base64 rendering of a payload, as usually found
+// in logs, back into raw bytes.
+func decodeText(data []byte, enc Encoding) ([]byte, error) {
+	switch enc {
+	case EncodingNone:
+		return data, nil
+	case EncodingHex:
+		return decodeHexText(string(data))
+	case EncodingBase64, EncodingBase64URL:
+		return decodeBase64Text(string(data), enc)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+func encodeText(data []byte, enc Encoding) ([]byte, error) {
+	switch enc {
+	case EncodingNone:
+		return data, nil
+	case EncodingHex:
+		return []byte(hex.EncodeToString(data)), nil
+	case EncodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(data)), nil
+	case EncodingBase64URL:
+		return []byte(base64.RawURLEncoding.EncodeToString(data)), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", enc)
+	}
+}
+
+// decodeHexText accepts plain hex as well as byte lists such as
+// "0x82 0xa3", "0x82,0xa3" and "\x82\xa3", ignoring whitespace throughout.
+func decodeHexText(s string) ([]byte, error) {
+	tokens := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+
+	var sb strings.Builder
+	for _, token := range tokens {
+		token = strings.ReplaceAll(token, `\x`, "")
+		token = strings.ReplaceAll(token, `\X`, "")
+		if strings.HasPrefix(token, "0x") || strings.HasPrefix(token, "0X") {
+			token = token[2:]
+		}
+		sb.WriteString(token)
+	}
+
+	out, err := hex.DecodeString(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("decode hex: %w", err)
+	}
+	return out, nil
+}
+
+// decodeBase64Text accepts padded and unpadded input with embedded
+// whitespace, as produced by line-wrapping tools.
+func decodeBase64Text(s string, enc Encoding) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimRight(s, "=")
+
+	encoding := base64.RawStdEncoding
+	if enc == EncodingBase64URL {
+		encoding = base64.RawURLEncoding
+	}
+
+	out, err := encoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", enc, err)
+	}
+	return out, nil
+}
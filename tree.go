@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultTreeDepth = 2
+	treeMaxItems     = 20
+	treeMaxString    = 60
+	treeMaxBytes     = 16
+)
+
+// treeRenderer draws a depth-limited outline of a document. Containers below
+// the depth limit collapse to `{…12 keys}` or `[…3000 items]`, long strings
+// and binaries are truncated, and --expand paths are opened regardless of
+// depth, with the depth limit starting over below them.
+type treeRenderer struct {
+	opts   options
+	depth  int
+	expand [][]pathSegment
+	sb     strings.Builder
+}
+
+func (o options) renderTree(data []byte, fromFormat Format) ([]byte, error) {
+	value, err := o.viewValue(data, fromFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &treeRenderer{opts: o, depth: o.treeDepth}
+	if r.depth == 0 {
+		r.depth = defaultTreeDepth
+	}
+	for _, p := range o.treeExpand {
+		segments, err := parsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		r.expand = append(r.expand, segments)
+	}
+
+	if err := r.node("$", value, nil, r.depth, 0); err != nil {
+		return nil, err
+	}
+	return []byte(r.sb.String()), nil
+}
+
+func (r *treeRenderer) node(label string, value interface{}, path []pathSegment, budget, indent int) error {
+	prefix := strings.Repeat("  ", indent) + label + ": "
+	if r.expanded(path) && !r.onExpandPath(path) {
+		budget = r.depth
+	}
+	open := budget > 0 || r.onExpandPath(path)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 || !open {
+			r.sb.WriteString(prefix + summarize(v, !open) + "\n")
+			return nil
+		}
+		r.sb.WriteString(prefix + summarize(v, false) + "\n")
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childLabel := key
+			if !isPlainPathKey(key) {
+				childLabel = strconv.Quote(key)
+			}
+			if err := r.node(childLabel, v[key], appendPath(path, keySegment(key)), budget-1, indent+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 || !open {
+			r.sb.WriteString(prefix + summarize(v, !open) + "\n")
+			return nil
+		}
+		r.sb.WriteString(prefix + summarize(v, false) + "\n")
+		hidden := 0
+		for i, item := range v {
+			itemPath := appendPath(path, indexSegment(i))
+			if i >= treeMaxItems && !r.expanded(itemPath) {
+				hidden++
+				continue
+			}
+			if err := r.node(fmt.Sprintf("[%d]", i), item, itemPath, budget-1, indent+1); err != nil {
+				return err
+			}
+		}
+		if hidden > 0 {
+			fmt.Fprintf(&r.sb, "%s… %s not shown\n", strings.Repeat("  ", indent+1), plural(hidden, "more item"))
+		}
+	default:
+		text, err := r.scalar(v)
+		if err != nil {
+			return err
+		}
+		r.sb.WriteString(prefix + text + "\n")
+	}
+	return nil
+}
+
+// expanded reports whether path is an --expand path or one of its ancestors.
+func (r *treeRenderer) expanded(path []pathSegment) bool {
+	for _, pattern := range r.expand {
+		if matchPath(pattern, path) {
+			return true
+		}
+	}
+	return r.onExpandPath(path)
+}
+
+// onExpandPath reports whether path is an ancestor of an --expand path.
+func (r *treeRenderer) onExpandPath(path []pathSegment) bool {
+	for _, pattern := range r.expand {
+		if len(pattern) > len(path) && matchPath(pattern[:len(path)], path) {
+			return true
+		}
+	}
+	return false
+}
+
+func summarize(value interface{}, collapsed bool) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return containerSummary(true, int64(len(v)), collapsed)
+	case []interface{}:
+		return containerSummary(false, int64(len(v)), collapsed)
+	}
+	return ""
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func (r *treeRenderer) scalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		if n := utf8.RuneCountInString(v); n > treeMaxString {
+			runes := []rune(v)
+			return fmt.Sprintf("%s… (%d chars)", strconv.Quote(string(runes[:treeMaxString])), n), nil
+		}
+		return strconv.Quote(v), nil
+	case []byte:
+		return "<bin " + plural(len(v), "byte") + "> " + truncatedHex(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case *extValue:
+		codec, ok := r.opts.extTypes[v.Type]
+		if !ok {
+			return fmt.Sprintf("<ext %d, %s> %s", v.Type, plural(len(v.Data), "byte"), truncatedHex(v.Data)), nil
+		}
+		decoded, err := codec.decode(v.Data)
+		if err != nil {
+			return "", fmt.Errorf("ext %d (%s): %w", v.Type, codec.Name, err)
+		}
+		text, err := outputStyle{compact: true}.encodeJSON(decoded)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("<ext %s> %s", codec.Name, text), nil
+	default:
+		text, err := outputStyle{compact: true}.encodeJSON(v)
+		return string(text), err
+	}
+}
+
+func truncatedHex(b []byte) string {
+	if len(b) > treeMaxBytes {
+		return hex.EncodeToString(b[:treeMaxBytes]) + "…"
+	}
+	return hex.EncodeToString(b)
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 var (
@@ -12,15 +14,73 @@ var (
 
 type options struct {
 	view         bool
+	color        colorMode
+	noPager      bool
+	tree         bool
+	treeDepth    int
+	treeExpand   []string
 	stdoutFormat Format
 	batchTarget  Format
+	force        bool
+	dryRun       bool
+	backup       bool
+	outDir       string
+	outTemplate  string
+	outArchive   string
+	recursive    bool
+	watch        bool
+	compress     Compression
+	decompress   Compression
+	level        int
+	jobs         int
+	keepGoing    bool
+	reportFile   string
+	newer        bool
+	manifestFile string
+	include      []string
+	exclude      []string
 	from         Format
 	to           Format
 	hasFrom      bool
 	hasTo        bool
+	keepComments bool
+	protoFile    string
+	protoName    string
+	protoType    protoreflect.MessageDescriptor
+	layoutFile   string
+	layout       layout
+	extFile      string
+	extTypes     extRegistry
+	style        outputStyle
+	inputEnc     Encoding
+	outputEnc    Encoding
 	inputs       []string
 }
 
+type codegenOptions struct {
+	lang      string
+	pkg       string
+	typeName  string
+	from      Format
+	output    string
+	typedDict bool
+	inputs    []string
+}
+
+type statsOptions struct {
+	from   Format
+	json   bool
+	top    int
+	inputs []string
+}
+
+type compareOptions struct {
+	from     Format
+	compress []string
+	runs     int
+	inputs   []string
+}
+
 type Format string
 
 const (
@@ -28,4 +88,37 @@ const (
 	FormatMsgpack Format = "msgpack"
 	FormatJSON    Format = "json"
 	FormatYAML    Format = "yaml"
+	FormatJSONC   Format = "jsonc"
+	FormatJSON5   Format = "json5"
+	FormatPlist   Format = "plist"
+	// FormatBinaryPlist shares the .plist extension with FormatPlist; it is
+	// only selected explicitly since decoding detects either encoding.
+	FormatBinaryPlist Format = "bplist"
+	FormatProtowire   Format = "protowire"
+	FormatGo          Format = "go"
+	FormatPython      Format = "python"
+	FormatTypeScript  Format = "ts"
+)
+
+// Encoding is a text transport wrapped around the raw bytes of a format, for
+// payloads copied out of logs.
+type Encoding string
+
+const (
+	EncodingNone      Encoding = ""
+	EncodingHex       Encoding = "hex"
+	EncodingBase64    Encoding = "base64"
+	EncodingBase64URL Encoding = "base64url"
+)
+
+// Compression wraps the bytes of a file. CompressionAuto picks it from the
+// file's extension when writing and from its magic bytes when reading.
+type Compression string
+
+const (
+	CompressionAuto Compression = ""
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+	CompressionXZ   Compression = "xz"
 )
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+type colorMode int
+
+const (
+	colorAuto colorMode = iota
+	colorAlways
+	colorNever
+)
+
+func parseColorMode(s string) (colorMode, error) {
+	switch s {
+	case "auto":
+		return colorAuto, nil
+	case "always":
+		return colorAlways, nil
+	case "never":
+		return colorNever, nil
+	default:
+		return colorAuto, fmt.Errorf("unknown color mode %q (want always, never or auto): %w", s, errUsage)
+	}
+}
+
+// ANSI colors used by --view. Msgpack-only types get their own colors so
+// they stand out from the JSON values they are rendered as.
+const (
+	colorReset  = "\x1b[0m"
+	colorKey    = "\x1b[1;34m"
+	colorString = "\x1b[32m"
+	colorNumber = "\x1b[36m"
+	colorBool   = "\x1b[33m"
+	colorNull   = "\x1b[90m"
+	colorBin    = "\x1b[35m"
+	colorExt    = "\x1b[31m"
+	colorTime   = "\x1b[93m"
+)
+
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// useColor applies --color, NO_COLOR and TERM=dumb, in that order.
+func (o options) useColor() bool {
+	switch o.color {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// viewValue decodes input for the custom --view renderers, leaving ext
+// values in place so they can be rendered differently from plain objects.
+func (o options) viewValue(data []byte, fromFormat Format) (interface{}, error) {
+	data, err := decodeText(data, o.inputEnc)
+	if err != nil {
+		return nil, err
+	}
+	value, err := o.decodeData(data, fromFormat)
+	if err != nil {
+		return nil, err
+	}
+	if o.layout != nil && fromFormat == FormatMsgpack {
+		if value, err = o.layout.expand(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// renderColor renders data as JSON with ANSI colors. It decodes the input
+// itself so bin, ext and timestamp values can be told apart.
+func (o options) renderColor(data []byte, fromFormat Format) ([]byte, error) {
+	value, err := o.viewValue(data, fromFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &highlighter{opts: o}
+	switch {
+	case o.style.compact:
+	case o.style.tabs:
+		h.indent = "\t"
+	case o.style.indent > 0:
+		h.indent = strings.Repeat(" ", o.style.indent)
+	default:
+		h.indent = "  "
+	}
+	if err := h.value(value, 0); err != nil {
+		return nil, err
+	}
+	return h.buf.Bytes(), nil
+}
+
+type highlighter struct {
+	opts   options
+	buf    bytes.Buffer
+	indent string
+	// override colors every token of an ext value with colorExt.
+	override string
+}
+
+func (h *highlighter) token(color, text string) {
+	if h.override != "" {
+		color = h.override
+	}
+	h.buf.WriteString(color + text + colorReset)
+}
+
+func (h *highlighter) newline(depth int) {
+	if h.indent == "" {
+		return
+	}
+	h.buf.WriteByte('\n')
+	h.buf.WriteString(strings.Repeat(h.indent, depth))
+}
+
+// scalar renders a leaf with the same escaping as the plain JSON output.
+func (h *highlighter) scalar(color string, value interface{}) error {
+	text, err := h.opts.style.encodeJSON(value)
+	if err != nil {
+		return err
+	}
+	h.token(color, string(text))
+	return nil
+}
+
+func (h *highlighter) value(value interface{}, depth int) error {
+	switch v := value.(type) {
+	case nil:
+		h.token(colorNull, "null")
+	case bool:
+		h.token(colorBool, fmt.Sprint(v))
+	case string:
+		return h.scalar(colorString, v)
+	case []byte:
+		return h.scalar(colorBin, base64.StdEncoding.EncodeToString(v))
+	case time.Time:
+		return h.scalar(colorTime, v)
+	case *extValue:
+		unpacked, err := h.opts.extTypes.unpack(v)
+		if err != nil {
+			return err
+		}
+		saved := h.override
+		h.override = colorExt
+		err = h.value(unpacked, depth)
+		h.override = saved
+		return err
+	case map[string]interface{}:
+		if len(v) == 0 {
+			h.buf.WriteString("{}")
+			return nil
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		h.buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				h.buf.WriteByte(',')
+			}
+			h.newline(depth + 1)
+			if err := h.scalar(colorKey, key); err != nil {
+				return err
+			}
+			h.buf.WriteByte(':')
+			if h.indent != "" {
+				h.buf.WriteByte(' ')
+			}
+			if err := h.value(v[key], depth+1); err != nil {
+				return err
+			}
+		}
+		h.newline(depth)
+		h.buf.WriteByte('}')
+	case []interface{}:
+		if len(v) == 0 {
+			h.buf.WriteString("[]")
+			return nil
+		}
+		h.buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				h.buf.WriteByte(',')
+			}
+			h.newline(depth + 1)
+			if err := h.value(item, depth+1); err != nil {
+				return err
+			}
+		}
+		h.newline(depth)
+		h.buf.WriteByte(']')
+	default:
+		return h.scalar(colorNumber, v)
+	}
+	return nil
+}
+
+// writeView writes view output to stdout, through $PAGER when stdout is a
+// terminal and the output does not fit on screen. An empty PAGER disables
+// paging; when the pager cannot be started the output is written directly.
+func (o options) writeView(out []byte) error {
+	if !o.noPager && isTerminal(os.Stdout) {
+		_, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err == nil && bytes.Count(out, []byte("\n")) >= height {
+			pager, ok := os.LookupEnv("PAGER")
+			if !ok {
+				pager = "less"
+			}
+			if pager != "" && pager != "cat" {
+				cmd := exec.Command("sh", "-c", pager)
+				cmd.Stdin = bytes.NewReader(out)
+				cmd.Stdout = os.Stdout
+				cmd.Stderr = os.Stderr
+				if _, ok := os.LookupEnv("LESS"); !ok {
+					// Keep colors and quit when the output fits after all.
+					cmd.Env = append(os.Environ(), "LESS=FRX")
+				}
+				if err := cmd.Start(); err == nil {
+					return cmd.Wait()
+				}
+			}
+		}
+	}
+
+	_, err := os.Stdout.Write(out)
+	return err
+}
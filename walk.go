@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const ignoreFileName = ".mptignore"
+
+// collectInputs lists the files a batch conversion reads, in a stable
+// order, along with the directory their outputs are mirrored from under
+// --out-dir. Files named on the command line are used as given; with -r,
+// directories are walked in lexical order.
+func (o options) collectInputs() ([]string, string, error) {
+	files, _, root, err := o.walkInputs()
+	return files, root, err
+}
+
+// walkInputs is collectInputs that also returns the directories holding
+// the inputs, which watch mode watches.
+func (o options) walkInputs() (files, dirs []string, root string, err error) {
+	var roots []string
+	w := &inputWalker{opts: o, visited: make(map[string]bool), own: make(map[string]bool)}
+	for _, name := range []string{o.manifestFile, o.reportFile} {
+		if name != "" {
+			w.own[absPath(name)] = true
+		}
+	}
+	for _, input := range o.inputs {
+		info, err := os.Stat(input)
+		if err != nil || !info.IsDir() {
+			files = append(files, input)
+			roots = append(roots, filepath.Dir(input))
+			continue
+		}
+		if !o.recursive {
+			return nil, nil, "", fmt.Errorf("%s is a directory (use -r to convert directories): %w", input, errUsage)
+		}
+		w.files = nil
+		if err := w.walk(input, "", nil); err != nil {
+			return nil, nil, "", err
+		}
+		files = append(files, w.files...)
+		roots = append(roots, input)
+	}
+	dirs = w.dirs
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		seen[absPath(dir)] = true
+	}
+	for _, dir := range roots {
+		if !seen[absPath(dir)] {
+			seen[absPath(dir)] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return files, dirs, commonDir(roots), nil
+}
+
+// inputWalker follows symlinks, remembering the real path of every
+// directory it enters so loops and trees linked twice are walked once.
+// The manifest and report files mpt writes itself are never inputs.
+type inputWalker struct {
+	opts    options
+	visited map[string]bool
+	own     map[string]bool
+	files   []string
+	dirs    []string
+}
+
+func (w *inputWalker) walk(dir, rel string, ignores []ignoreRule) error {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if w.visited[real] {
+		return nil
+	}
+	w.visited[real] = true
+	w.dirs = append(w.dirs, dir)
+
+	rules, err := readIgnoreFile(filepath.Join(dir, ignoreFileName), rel)
+	if err != nil {
+		return err
+	}
+	ignores = append(ignores[:len(ignores):len(ignores)], rules...)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == ignoreFileName {
+			continue
+		}
+		full := filepath.Join(dir, entry.Name())
+		childRel := path.Join(rel, entry.Name())
+		info, err := os.Stat(full)
+		if errors.Is(err, fs.ErrNotExist) {
+			// A dangling symlink.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if ignored(ignores, childRel, info.IsDir()) || w.excluded(childRel, info.IsDir()) {
+			continue
+		}
+		if info.IsDir() {
+			if err := w.walk(full, childRel, ignores); err != nil {
+				return err
+			}
+		} else if !w.own[absPath(full)] && w.included(full, childRel) {
+			w.files = append(w.files, full)
+		}
+	}
+	return nil
+}
+
+// excluded prunes whole directories when an --exclude pattern covers
+// everything below them, like vendor/**.
+func (w *inputWalker) excluded(rel string, isDir bool) bool {
+	for _, pattern := range w.opts.exclude {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok && isDir && matchGlob(prefix, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// included applies --include. Without it, files in the formats mpt reads as
+// data are picked up. Files already in the target format are skipped either
+// way, so outputs written into the tree are not converted on the next run.
+func (w *inputWalker) included(full, rel string) bool {
+	if len(w.opts.include) > 0 {
+		matched := false
+		for _, pattern := range w.opts.include {
+			if matchGlob(pattern, rel) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+		if w.opts.hasFrom {
+			return true
+		}
+	}
+
+	format, err := detectFormat(full)
+	if err != nil || format == w.opts.batchTarget {
+		return false
+	}
+	if len(w.opts.include) > 0 {
+		return true
+	}
+	switch format {
+	case FormatMsgpack, FormatJSON, FormatYAML, FormatJSONC, FormatJSON5, FormatPlist:
+		return true
+	}
+	return false
+}
+
+// ignoreRule is one line of a .mptignore file, relative to the directory
+// holding it.
+type ignoreRule struct {
+	base    string
+	pattern string
+	dirOnly bool
+}
+
+func readIgnoreFile(name, base string) ([]ignoreRule, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		text, rule.dirOnly = strings.CutSuffix(text, "/")
+		rule.pattern = strings.TrimPrefix(text, "/")
+		if err := checkGlob(rule.pattern); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if rule.base != "" {
+			name = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		if matchGlob(rule.pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated path relative to the walked
+// directory. Patterns without a slash match the base name at any depth,
+// and ** matches any number of directories.
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func checkGlob(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", pattern, err)
+	}
+	return nil
+}
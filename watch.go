@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const watchDebounce = 100 * time.Millisecond
+
+// watcher reconverts batch inputs as they change. Events are collected
+// until none has arrived for watchDebounce, so the burst of writes and
+// renames an editor makes for one save leads to one conversion.
+type watcher struct {
+	opts    options
+	events  *fsnotify.Watcher
+	log     io.Writer
+	watched map[string]bool
+}
+
+func (o options) watchFiles() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w, err := o.newWatcher(os.Stderr)
+	if err != nil {
+		return err
+	}
+	defer w.events.Close()
+	fmt.Fprintf(os.Stderr, "watching %s for changes\n", strings.Join(o.inputs, ", "))
+	return w.run(ctx)
+}
+
+func (o options) newWatcher(log io.Writer) (*watcher, error) {
+	events, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{opts: o, events: events, log: log, watched: make(map[string]bool)}
+	if _, _, err := w.scan(); err != nil {
+		events.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// scan walks the inputs again, watching directories that appeared since
+// the last scan, and returns the files a change may convert by absolute
+// path.
+func (w *watcher) scan() (map[string]string, string, error) {
+	files, dirs, root, err := w.opts.walkInputs()
+	if err != nil {
+		return nil, "", err
+	}
+	for _, dir := range dirs {
+		key := absPath(dir)
+		if w.watched[key] {
+			continue
+		}
+		if err := w.events.Add(dir); err != nil {
+			return nil, "", fmt.Errorf("watch %s: %w", dir, err)
+		}
+		w.watched[key] = true
+	}
+
+	inputs := make(map[string]string, len(files))
+	for _, file := range files {
+		inputs[absPath(file)] = file
+	}
+	return inputs, root, nil
+}
+
+func (w *watcher) run(ctx context.Context) error {
+	changed := make(map[string]bool)
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.events.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(w.log, "watch: %v\n", err)
+		case event, ok := <-w.events.Events:
+			if !ok {
+				return nil
+			}
+			path := absPath(event.Name)
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// The kernel drops the watch on a directory that goes
+				// away, so it is added again if the directory comes back.
+				delete(w.watched, path)
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				changed[path] = true
+				timer.Reset(watchDebounce)
+			}
+		case <-timer.C:
+			w.convert(changed)
+			changed = make(map[string]bool)
+		}
+	}
+}
+
+// convert reconverts the changed inputs, and every input below a changed
+// directory, since files moved in with a directory raise no events of
+// their own. Failures are logged and watching goes on.
+func (w *watcher) convert(changed map[string]bool) {
+	inputs, root, err := w.scan()
+	if err != nil {
+		fmt.Fprintf(w.log, "watch: %v\n", err)
+		return
+	}
+
+	paths := make([]string, 0, len(inputs))
+	for path := range inputs {
+		if underChanged(path, changed) && fileExists(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	o := w.opts
+	o.force, o.keepGoing = true, true
+	jobs := make([]batchJob, 0, len(paths))
+	for _, path := range paths {
+		input := inputs[path]
+		fromFormat, err := o.resolveFromFormat(input)
+		jobs = append(jobs, batchJob{
+			input:  input,
+			output: o.batchDestination(input, root),
+			from:   fromFormat,
+			to:     o.batchTarget,
+			err:    err,
+		})
+	}
+	if len(jobs) == 0 {
+		return
+	}
+	if err := o.checkJobs(jobs); err != nil {
+		fmt.Fprintf(w.log, "watch: %v\n", err)
+		return
+	}
+
+	errs, _ := o.convertJobs(jobs)
+	for i, job := range jobs {
+		if errs[i] != nil {
+			fmt.Fprintf(w.log, "%s: %v\n", job.input, errs[i])
+			continue
+		}
+		fmt.Fprintf(w.log, "%s -> %s\n", job.input, job.output)
+	}
+}
+
+func underChanged(path string, changed map[string]bool) bool {
+	for {
+		if changed[path] {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
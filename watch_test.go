@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if fileExists(path) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s was not written", path)
+}
+
+func TestWatchReconverts(t *testing.T) {
+	dir := setupTestDir(t)
+	opts, err := parseArgs([]string{"--watch", dir, "--to-msgpack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	w, err := opts.newWatcher(&log)
+	if err != nil {
+		t.Fatalf("newWatcher: %v", err)
+	}
+	defer w.events.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.run(ctx) }()
+
+	writeTestFile(t, filepath.Join(dir, "a.yaml"), []byte("a: 1\n"))
+	waitForFile(t, filepath.Join(dir, "a.msgpack"))
+
+	// A malformed save is reported and watching continues.
+	writeTestFile(t, filepath.Join(dir, "bad.yaml"), []byte("a: [1\n"))
+
+	// A directory moved in is watched, and the files it holds converted.
+	staging := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(staging, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(staging, "nested", "b.json"), []byte(`{"b":2}`))
+	if err := os.Rename(filepath.Join(staging, "nested"), filepath.Join(dir, "nested")); err != nil {
+		t.Skipf("cannot move directories between temp dirs: %v", err)
+	}
+	waitForFile(t, filepath.Join(dir, "nested", "b.msgpack"))
+
+	// An editor-style save: write a temp file, then rename it over the input.
+	tmp := filepath.Join(dir, "nested", ".c.yaml.swp")
+	writeTestFile(t, tmp, []byte("c: 3\n"))
+	if err := os.Rename(tmp, filepath.Join(dir, "nested", "c.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dir, "nested", "c.msgpack"))
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watch returned %v", err)
+	}
+	if !strings.Contains(log.String(), "bad.yaml: ") {
+		t.Errorf("expected the malformed input to be reported, got:\n%s", log.String())
+	}
+	if fileExists(filepath.Join(dir, "bad.msgpack")) {
+		t.Error("a failed conversion should not write output")
+	}
+
+	_, err = parseArgs([]string{"--watch", dir})
+	assertError(t, err, "watch requires --to-json")
+}